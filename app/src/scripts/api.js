@@ -12,16 +12,157 @@ export function setPlayerID(playerID) {
     localStorage.setItem("playerID", playerID)
 }
 
+// The seat token proves who the player is, the PlayerID alone is not enough
+export function getToken() {
+    return localStorage.getItem("token")
+}
+
+export function setToken(token) {
+    localStorage.setItem("token", token)
+}
+
+// The public name of the player shown to opponents
+export function getHandle() {
+    return localStorage.getItem("handle")
+}
+
+export function setHandle(handle) {
+    localStorage.setItem("handle", handle)
+}
 
-export async function startGame(time, increment) {
-    let playerID = getPlayerID()
+
+export async function startGame(time, increment, color) {
     return axios.post('/play', {
-        playerID: playerID,
+        token: getToken(),
         time: ((time) ? time : defaultTime),
         increment: ((increment) ? increment : defaultIncrement),
+        color: ((color) ? color : "random"),
     }).then(response => {
+        setPlayerID(response.data.PlayerID)
+        setHandle(response.data.Handle)
+        setToken(response.data.Token)
         return response.data
     }).catch(error => {
         console.log("ERROR: ", error)
     })
 }
+
+// Store the player of a game response
+function joined(data) {
+    setPlayerID(data.PlayerID)
+    setHandle(data.Handle)
+    setToken(data.Token)
+    return data
+}
+
+// Post a seek on the seek board. color is "white", "black" or "random",
+// minRating and maxRating limit opponents, 0 for any.
+export async function postSeek(time, increment, color, rated, minRating, maxRating) {
+    return axios.post('/seeks', {
+        token: getToken(),
+        time: ((time) ? time : defaultTime),
+        increment: ((increment) ? increment : defaultIncrement),
+        color: color,
+        rated: rated,
+        minRating: minRating,
+        maxRating: maxRating,
+    }).then(response => joined(response.data))
+}
+
+// Accept a seek from the seek board
+export async function acceptSeek(gameID) {
+    return axios.post('/seeks/' + gameID, {
+        token: getToken(),
+    }).then(response => joined(response.data))
+}
+
+// Create a private game, send the link of the game to a friend
+export async function challengeFriend(time, increment, color) {
+    return axios.post('/challenge', {
+        token: getToken(),
+        time: ((time) ? time : defaultTime),
+        increment: ((increment) ? increment : defaultIncrement),
+        color: color,
+    }).then(response => joined(response.data))
+}
+
+// Challenge the player with handle, they are notified and can accept
+// until the challenge expires
+export async function challengePlayer(handle, time, increment, color) {
+    return axios.post('/players/' + encodeURIComponent(handle) + '/challenge', {
+        token: getToken(),
+        time: ((time) ? time : defaultTime),
+        increment: ((increment) ? increment : defaultIncrement),
+        color: color,
+    }).then(response => response.data)
+}
+
+// Get the open challenges sent and received by the player
+export async function getChallenges() {
+    const token = getToken()
+    return axios.get('/challenges', {
+        headers: (token) ? { Authorization: 'Bearer ' + token } : {},
+    }).then(response => response.data)
+}
+
+// Accept a challenge, the challenger is notified with the game
+export async function acceptChallenge(id) {
+    return axios.post('/challenges/' + id + '/accept', {
+        token: getToken(),
+    }).then(response => joined(response.data))
+}
+
+export async function declineChallenge(id) {
+    return axios.post('/challenges/' + id + '/decline', { token: getToken() })
+}
+
+export async function cancelChallenge(id) {
+    return axios.post('/challenges/' + id + '/cancel', { token: getToken() })
+}
+
+// Join a tournament, its games are sent as notifications
+export async function joinTournament(id) {
+    return axios.post('/tournaments/' + id + '/join', { token: getToken() })
+}
+
+export async function withdrawTournament(id) {
+    return axios.post('/tournaments/' + id + '/withdraw', { token: getToken() })
+}
+
+// Get the games between the players of a swiss, round robin or knockout
+export async function getCrosstable(id) {
+    return axios.get('/tournaments/' + id + '/crosstable').then(response => response.data)
+}
+
+// Create an account. The server sets the session cookie.
+export async function register(username, password) {
+    return axios.post('/register', {
+        username: username,
+        password: password,
+    }).then(response => {
+        setPlayerID(response.data.PlayerID)
+        setHandle(response.data.Username)
+        localStorage.removeItem("token") // the session cookie is used instead
+        return response.data
+    })
+}
+
+// Log in to an account. The server sets the session cookie.
+export async function login(username, password) {
+    return axios.post('/login', {
+        username: username,
+        password: password,
+    }).then(response => {
+        setPlayerID(response.data.PlayerID)
+        setHandle(response.data.Username)
+        localStorage.removeItem("token") // the session cookie is used instead
+        return response.data
+    })
+}
+
+export async function logout() {
+    return axios.post('/logout').then(() => {
+        localStorage.removeItem("playerID")
+        localStorage.removeItem("handle")
+    })
+}
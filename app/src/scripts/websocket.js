@@ -1,5 +1,5 @@
 import { ref } from 'vue'
-import { getPlayerID } from './api.js'
+import { getToken } from './api.js'
 
 const gameID = ref("")
 
@@ -21,7 +21,7 @@ export function useWebsocket(id) {
             // Request game and join
             const msg = {
                 action: "join",
-                playerID: getPlayerID(),
+                token: getToken(),
                 date: Date.now(),
             };
             CONN.send(JSON.stringify(msg));
@@ -32,12 +32,64 @@ export function useWebsocket(id) {
     return CONN
 }
 
+// Watch the seek board, onSeeks is called with every open seek whenever
+// they change
+export function watchSeeks(onSeeks) {
+    if (!window["WebSocket"]) {
+        return null
+    }
+    const conn = new WebSocket("wss://" + document.location.host + "/lobby/seeks");
+    conn.onmessage = function(event) {
+        const parsed = JSON.parse(event.data)
+        if (parsed.Action == "seeks") {
+            onSeeks(parsed.Seeks)
+        }
+    };
+    return conn
+}
+
+// Listen for notifications like challenges, onNotification is called
+// with every notification
+export function watchNotifications(onNotification) {
+    if (!window["WebSocket"]) {
+        return null
+    }
+    const conn = new WebSocket("wss://" + document.location.host + "/notifications");
+    conn.onopen = function(event) {
+        conn.send(JSON.stringify({ token: getToken() }));
+    }
+    conn.onmessage = function(event) {
+        onNotification(JSON.parse(event.data))
+    };
+    return conn
+}
+
+// Watch the standings of a tournament, onUpdate is called with the
+// tournament and its standings whenever they change
+export function watchStandings(id, onUpdate) {
+    if (!window["WebSocket"]) {
+        return null
+    }
+    const conn = new WebSocket("wss://" + document.location.host + "/tournaments/" + id);
+    conn.onmessage = function(event) {
+        const parsed = JSON.parse(event.data)
+        if (parsed.Action == "standings") {
+            onUpdate(parsed.Tournament, parsed.Standings)
+        }
+    };
+    return conn
+}
+
+export function sendBerserk() {
+    if (CONN != null) {
+        CONN.send(JSON.stringify({ Action: "berserk" }));
+    }
+}
 
 export function sendMove(move) {
     if (CONN != null) {
         const msg = {
             Action: "move",
-            PlayerID: getPlayerID(),
             GameID: gameID.value,
             Move: move,
         };
@@ -49,7 +101,6 @@ export function sendResign() {
     if (CONN != null) {
         const msg = {
             Action: "resign",
-            PlayerID: getPlayerID(),
         };
         CONN.send(JSON.stringify(msg));
     }
@@ -59,7 +110,6 @@ export function sendDrawRequest() {
     if (CONN != null) {
         const msg = {
             Action: "draw_request",
-            PlayerID: getPlayerID(),
         };
         CONN.send(JSON.stringify(msg));
     }
@@ -69,7 +119,6 @@ export function acceptDraw() {
     if (CONN != null) {
         const msg = {
             Action: "draw_accept",
-            PlayerID: getPlayerID(),
         };
         CONN.send(JSON.stringify(msg));
     }
@@ -79,7 +128,6 @@ export function denyDraw() {
     if (CONN != null) {
         const msg = {
             Action: "draw_deny",
-            PlayerID: getPlayerID(),
         };
         CONN.send(JSON.stringify(msg));
     }
@@ -89,7 +137,6 @@ export function sendAbort() {
     if (CONN != null) {
         const msg = {
             Action: "abort",
-            PlayerID: getPlayerID(),
         };
         CONN.send(JSON.stringify(msg));
     }
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"github.com/JDRadatti/reptile/internal/api"
+	"github.com/JDRadatti/reptile/internal/auth"
+	"github.com/JDRadatti/reptile/internal/store"
+	"github.com/JDRadatti/reptile/internal/tournament"
 	"github.com/JDRadatti/reptile/internal/websocket"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var addr = flag.String("addr", ":3000", "http server address")
+var (
+	addr         = flag.String("addr", ":3000", "http server address")
+	tolerance    = flag.Float64("tolerance", 0, "fraction by which paired players' time controls can differ")
+	accountsPath = flag.String("accounts", "accounts.json", "file the player accounts are saved to")
+	games        = flag.String("games", "games.jsonl", "file finished games are archived to")
+	journal      = flag.String("journal", "journal.jsonl", "file running games are logged to, to recover them after a restart")
+	drain        = flag.Duration("drain", time.Minute, "how long running games have to finish when the server shuts down")
+	secret       = flag.String("secret", os.Getenv("REPTILE_SECRET"), "key tokens are signed with, random if empty")
+)
 
-func serveHome(lobby *websocket.Lobby) {
+func newServer(lobby *websocket.Lobby, tournaments *tournament.Tournaments) *http.Server {
 	router := http.NewServeMux()
 
 	router.HandleFunc("POST /play", func(w http.ResponseWriter, r *http.Request) {
@@ -20,9 +37,102 @@ func serveHome(lobby *websocket.Lobby) {
 		http.ServeFile(w, r, "app/dist/index.html")
 	})
 
+	router.HandleFunc("POST /register", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleRegister(w, r, lobby)
+	})
+	router.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleLogin(w, r, lobby)
+	})
+	router.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleLogout(w)
+	})
+
 	router.HandleFunc("GET /lobby", func(w http.ResponseWriter, r *http.Request) {
 		api.HandleLobby(w, lobby)
 	})
+	router.HandleFunc("GET /lobby/pools", func(w http.ResponseWriter, r *http.Request) {
+		api.HandlePools(w, lobby)
+	})
+
+	router.HandleFunc("GET /lobby/seeks", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["Upgrade"]; ok {
+			handler := &websocket.SeeksHandler{Lobby: lobby}
+			handler.ServeHTTP(w, r)
+		} else {
+			api.HandleSeeks(w, lobby)
+		}
+	})
+	router.HandleFunc("POST /seeks", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleSeek(w, r, lobby)
+	})
+	router.HandleFunc("POST /seeks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleAccept(w, r, lobby)
+	})
+	router.HandleFunc("POST /challenge", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleChallenge(w, r, lobby)
+	})
+
+	router.HandleFunc("GET /players/{handle}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleProfile(w, r, lobby)
+	})
+	router.HandleFunc("POST /players/{handle}/challenge", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleChallengePlayer(w, r, lobby)
+	})
+	router.HandleFunc("GET /challenges", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleChallenges(w, r, lobby)
+	})
+	router.HandleFunc("POST /challenges/{id}/accept", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleAcceptChallenge(w, r, lobby)
+	})
+	router.HandleFunc("POST /challenges/{id}/decline", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleDeclineChallenge(w, r, lobby)
+	})
+	router.HandleFunc("POST /challenges/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleCancelChallenge(w, r, lobby)
+	})
+	router.HandleFunc("GET /notifications", func(w http.ResponseWriter, r *http.Request) {
+		handler := &websocket.NotificationsHandler{Lobby: lobby}
+		handler.ServeHTTP(w, r)
+	})
+
+	router.HandleFunc("GET /tournaments", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTournaments(w, tournaments)
+	})
+	router.HandleFunc("POST /tournaments", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleCreateTournament(w, r, lobby, tournaments)
+	})
+	router.HandleFunc("GET /tournaments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["Upgrade"]; !ok {
+			api.HandleTournament(w, r, tournaments)
+		} else if t, ok := tournaments.Get(r.PathValue("id")); ok {
+			handler := &tournament.StandingsHandler{Tournament: t}
+			handler.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+	router.HandleFunc("GET /tournaments/{id}/crosstable", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleCrosstable(w, r, tournaments)
+	})
+	router.HandleFunc("GET /tournaments/{id}/trf", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleTRF(w, r, tournaments)
+	})
+	router.HandleFunc("POST /tournaments/{id}/join", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleJoinTournament(w, r, lobby, tournaments)
+	})
+	router.HandleFunc("POST /tournaments/{id}/withdraw", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleWithdraw(w, r, lobby, tournaments)
+	})
+
+	router.HandleFunc("GET /api/games", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleGames(w, r, lobby)
+	})
+	router.HandleFunc("GET /api/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleGame(w, r, lobby)
+	})
+	router.HandleFunc("GET /api/games/export", func(w http.ResponseWriter, r *http.Request) {
+		api.HandleExport(w, r, lobby)
+	})
 
 	router.HandleFunc("GET /game/{id}", func(w http.ResponseWriter, r *http.Request) {
 		if _, ok := r.Header["Upgrade"]; ok {
@@ -37,12 +147,57 @@ func serveHome(lobby *websocket.Lobby) {
 		}
 	})
 	router.Handle("/", http.FileServer(http.Dir("app/dist")))
-	log.Println("http server listening from", *addr)
-	log.Panic(http.ListenAndServe(*addr, router))
+	return &http.Server{Addr: *addr, Handler: router}
 }
 
 func main() {
 	flag.Parse()
-	lobby := websocket.NewLobby()
-	serveHome(lobby)
+	accounts, err := auth.NewAccounts(*accountsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *secret == "" {
+		log.Println("no -secret given, sessions end when the server restarts")
+	}
+	archive, err := store.OpenFile(*games)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer archive.Close()
+	running, err := store.OpenJournal(*journal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer running.Close()
+	lobby := websocket.NewLobby(
+		websocket.WithTolerance(*tolerance),
+		websocket.WithAuth(accounts, auth.NewSigner([]byte(*secret))),
+		websocket.WithStore(archive),
+		websocket.WithJournal(running),
+	)
+	server := newServer(lobby, tournament.New(lobby))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		log.Println("http server listening from", *addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Panic(err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+
+	// the server keeps running while draining so players can reconnect
+	log.Printf("shutting down, draining games for %s", *drain)
+	drainCtx, cancel := context.WithTimeout(context.Background(), *drain)
+	defer cancel()
+	if err := lobby.Shutdown(drainCtx); err != nil {
+		log.Println("stopped unfinished games:", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error: %v", err)
+	}
 }
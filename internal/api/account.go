@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/JDRadatti/reptile/internal/auth"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Credentials are sent from the client to register or log in
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Session is sent to the client after registering or logging in. The
+// token is also set as an HttpOnly cookie.
+type Session struct {
+	Username string
+	PlayerID websocket.PlayerID
+	Token    string
+}
+
+// HandleRegister creates an account and logs the player in
+func HandleRegister(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	credentials := &Credentials{}
+	if err := json.NewDecoder(r.Body).Decode(credentials); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := lobby.Accounts.Register(credentials.Username, credentials.Password)
+	if errors.Is(err, auth.ErrUsernameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSession(w, lobby, account)
+}
+
+// HandleLogin logs the player in if the credentials are correct
+func HandleLogin(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	credentials := &Credentials{}
+	if err := json.NewDecoder(r.Body).Decode(credentials); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := lobby.Accounts.Login(credentials.Username, credentials.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	writeSession(w, lobby, account)
+}
+
+// HandleLogout removes the session cookie
+func HandleLogout(w http.ResponseWriter) {
+	http.SetCookie(w, auth.ClearCookie())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSession(w http.ResponseWriter, lobby *websocket.Lobby, account auth.Account) {
+	token := lobby.Signer.Sign(auth.SESSION, account.PlayerID, time.Now().Add(auth.SessionDuration))
+	payload, err := json.Marshal(Session{
+		Username: account.Username,
+		PlayerID: websocket.PlayerID(account.PlayerID),
+		Token:    token,
+	})
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, auth.SessionCookie(token))
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
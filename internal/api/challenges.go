@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/JDRadatti/reptile/internal/auth"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"net/http"
+)
+
+// HandleChallengePlayer challenges the player with the handle in the
+// path. The challenger needs a token to be notified of the answer.
+func HandleChallengePlayer(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	gameRequest, ok := readGameRequest(w, r, lobby)
+	if !ok {
+		return
+	} else if gameRequest.Token == "" && auth.RequestToken(r) == "" {
+		http.Error(w, "log in or play a game to challenge players", http.StatusUnauthorized)
+		return
+	}
+	status, err := lobby.ChallengePlayer(gameRequest, r.PathValue("handle"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// HandleChallenges writes the open challenges sent and received by the
+// player of the request
+func HandleChallenges(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if pid, ok := readPlayer(w, r, lobby); ok {
+		writeJSON(w, lobby.Challenges(pid))
+	}
+}
+
+// HandleAcceptChallenge joins the game of the challenge in the path. Only
+// the token and color of the request body are used.
+func HandleAcceptChallenge(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if gameRequest, ok := readGameRequest(w, r, lobby); ok {
+		writeGameResponse(w, lobby.AcceptChallenge(gameRequest, websocket.ChallengeID(r.PathValue("id"))))
+	}
+}
+
+// HandleDeclineChallenge declines the challenge in the path
+func HandleDeclineChallenge(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if pid, ok := readPlayer(w, r, lobby); ok {
+		if err := lobby.DeclineChallenge(pid, websocket.ChallengeID(r.PathValue("id"))); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	}
+}
+
+// HandleCancelChallenge takes back the challenge in the path
+func HandleCancelChallenge(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if pid, ok := readPlayer(w, r, lobby); ok {
+		if err := lobby.CancelChallenge(pid, websocket.ChallengeID(r.PathValue("id"))); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	}
+}
+
+// readPlayer returns the player of the token of r, or of the Token of
+// its body. Writes the error and returns false if there is none.
+func readPlayer(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) (websocket.PlayerID, bool) {
+	token := auth.RequestToken(r)
+	if token == "" {
+		body := struct{ Token string }{}
+		json.NewDecoder(r.Body).Decode(&body) // the body is optional
+		token = body.Token
+	}
+	pid, err := lobby.Authenticate(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return pid, true
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/store"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultGamesLimit = 20
+	maxGamesLimit     = 100
+	exportPageSize    = 100
+)
+
+// GameSummary is a finished game without its moves
+type GameSummary struct {
+	ID          string
+	White       string
+	Black       string
+	TimeControl string
+	Variant     string
+	Rated       bool
+	Started     time.Time
+	Ended       time.Time
+	Result      string
+	Termination string
+	Plies       int
+}
+
+// GamePage is a page of games. Next is the cursor of the next page,
+// empty on the last page.
+type GamePage struct {
+	Games []GameSummary
+	Next  string `json:",omitempty"`
+}
+
+// GameDetail is a finished game with the position after every ply.
+// FENs[0] is the starting position and FENs[i] the position after Moves[i-1].
+type GameDetail struct {
+	store.Game
+	FENs []string
+	PGN  string
+}
+
+func summary(g store.Game) GameSummary {
+	return GameSummary{
+		ID:          g.ID,
+		White:       g.White,
+		Black:       g.Black,
+		TimeControl: g.TimeControl,
+		Variant:     g.Variant,
+		Rated:       g.Rated,
+		Started:     g.Started,
+		Ended:       g.Ended,
+		Result:      g.Result,
+		Termination: g.Termination,
+		Plies:       len(g.Moves),
+	}
+}
+
+// parseTime accepts a date like 2024-05-01 or an RFC 3339 time
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseQuery reads the player, result, since, until and cursor
+// parameters of r
+func parseQuery(r *http.Request) (store.Query, error) {
+	params := r.URL.Query()
+	q := store.Query{
+		Player: params.Get("player"),
+		Result: params.Get("result"),
+		Cursor: params.Get("cursor"),
+	}
+	var err error
+	if since := params.Get("since"); since != "" {
+		if q.Since, err = parseTime(since); err != nil {
+			return q, fmt.Errorf("invalid since %q", since)
+		}
+	}
+	if until := params.Get("until"); until != "" {
+		if q.Until, err = parseTime(until); err != nil {
+			return q, fmt.Errorf("invalid until %q", until)
+		}
+	}
+	return q, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+// archive returns the lobby's store or writes an error if it has none
+func archive(w http.ResponseWriter, l *websocket.Lobby) (store.Store, bool) {
+	if l.Store == nil {
+		http.Error(w, "games are not archived", http.StatusNotFound)
+		return nil, false
+	}
+	return l.Store, true
+}
+
+// HandleGames writes a page of finished games, most recent first
+func HandleGames(w http.ResponseWriter, r *http.Request, l *websocket.Lobby) {
+	s, ok := archive(w, l)
+	if !ok {
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit = defaultGamesLimit
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 || q.Limit > maxGamesLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxGamesLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	games, err := s.Find(q)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := GamePage{Games: make([]GameSummary, len(games))}
+	for i, g := range games {
+		page.Games[i] = summary(g)
+	}
+	if len(games) == q.Limit {
+		page.Next = store.CursorOf(games[len(games)-1])
+	}
+	writeJSON(w, page)
+}
+
+// HandleGame writes a finished game with the position after every ply
+func HandleGame(w http.ResponseWriter, r *http.Request, l *websocket.Lobby) {
+	s, ok := archive(w, l)
+	if !ok {
+		return
+	}
+	g, err := s.Get(r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	board := chess.NewBoardClassic()
+	fens := []string{string(board.FEN())}
+	for _, move := range g.Coordinates {
+		if _, ok := board.Move(move); !ok {
+			log.Printf("error: game %s has illegal move %s", g.ID, move)
+			break
+		}
+		fens = append(fens, string(board.FEN()))
+	}
+	writeJSON(w, GameDetail{Game: g, FENs: fens, PGN: g.PGN()})
+}
+
+// HandleExport streams every game matching the query, usually all games
+// of a player, as one PGN file
+func HandleExport(w http.ResponseWriter, r *http.Request, l *websocket.Lobby) {
+	s, ok := archive(w, l)
+	if !ok {
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit = exportPageSize
+
+	filename := "games.pgn"
+	if q.Player != "" {
+		filename = q.Player + ".pgn"
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	flusher, _ := w.(http.Flusher)
+	for page := 0; ; page++ {
+		games, err := s.Find(q)
+		if err != nil && page == 0 {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("error: %v", err)
+			return // the response has started, the client sees a truncated file
+		}
+		for _, g := range games {
+			if _, err := fmt.Fprintln(w, g.PGN()); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(games) < q.Limit {
+			return
+		}
+		q.Cursor = store.CursorOf(games[len(games)-1])
+	}
+}
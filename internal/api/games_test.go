@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/store"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func gamesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	s, err := store.OpenFile(filepath.Join(t.TempDir(), "games.jsonl"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	ended := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, s.Save(store.Game{
+			ID:          id,
+			White:       "alice",
+			Black:       "bob",
+			TimeControl: "300",
+			Result:      "1-0",
+			Started:     ended,
+			Ended:       ended.Add(time.Duration(i) * time.Hour),
+			Moves:       []string{"e4", "e5"},
+			Coordinates: []string{"e2e4", "e7e5"},
+			Clocks:      []int{299000, 298000},
+		}))
+	}
+
+	l := websocket.NewLobby(websocket.WithStore(s))
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/games", func(w http.ResponseWriter, r *http.Request) {
+		HandleGames(w, r, l)
+	})
+	router.HandleFunc("GET /api/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+		HandleGame(w, r, l)
+	})
+	router.HandleFunc("GET /api/games/export", func(w http.ResponseWriter, r *http.Request) {
+		HandleExport(w, r, l)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, url string, v any) *http.Response {
+	t.Helper()
+
+	response, err := http.Get(url)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	if v != nil && response.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(v))
+	}
+	return response
+}
+
+func TestHandleGames(t *testing.T) {
+	server := gamesServer(t)
+
+	page := GamePage{}
+	get(t, server.URL+"/api/games?player=alice&limit=2", &page)
+	assert.Len(t, page.Games, 2)
+	assert.Equal(t, "c", page.Games[0].ID)
+	assert.Equal(t, 2, page.Games[0].Plies)
+	assert.NotEmpty(t, page.Next)
+
+	last := GamePage{}
+	get(t, server.URL+"/api/games?player=alice&limit=2&cursor="+page.Next, &last)
+	assert.Len(t, last.Games, 1)
+	assert.Equal(t, "a", last.Games[0].ID)
+	assert.Empty(t, last.Next)
+
+	empty := GamePage{}
+	get(t, server.URL+"/api/games?since=2024-05-02", &empty)
+	assert.Empty(t, empty.Games)
+
+	assert.Equal(t, http.StatusBadRequest, get(t, server.URL+"/api/games?limit=1000", nil).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, get(t, server.URL+"/api/games?cursor=x", nil).StatusCode)
+}
+
+func TestHandleGame(t *testing.T) {
+	server := gamesServer(t)
+
+	game := GameDetail{}
+	get(t, server.URL+"/api/games/a", &game)
+	assert.Equal(t, []int{299000, 298000}, game.Clocks)
+	assert.Len(t, game.FENs, 3)
+	board := chess.NewBoardClassic()
+	assert.Equal(t, string(board.FEN()), game.FENs[0])
+	board.Move("e2e4")
+	board.Move("e7e5")
+	assert.Equal(t, string(board.FEN()), game.FENs[2])
+	assert.Contains(t, game.PGN, "1. e4 e5 1-0")
+
+	assert.Equal(t, http.StatusNotFound, get(t, server.URL+"/api/games/d", nil).StatusCode)
+}
+
+func TestHandleExport(t *testing.T) {
+	server := gamesServer(t)
+
+	response, err := http.Get(server.URL + "/api/games/export?player=bob")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(body), "[Event "))
+	assert.Contains(t, response.Header.Get("Content-Disposition"), "bob.pgn")
+}
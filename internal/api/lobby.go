@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"github.com/JDRadatti/reptile/internal/websocket"
 	"log"
 	"net/http"
@@ -13,3 +14,19 @@ func HandleLobby(w http.ResponseWriter, l *websocket.Lobby) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// HandlePools writes the number of players waiting in each matchmaking pool
+func HandlePools(w http.ResponseWriter, l *websocket.Lobby) {
+	payload, err := json.Marshal(l.Pools())
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
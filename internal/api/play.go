@@ -2,29 +2,55 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/JDRadatti/reptile/internal/auth"
 	"github.com/JDRadatti/reptile/internal/websocket"
-	"github.com/google/uuid"
 	"log"
 	"net/http"
 )
 
 // HandlePlay handles online game requests
 func HandlePlay(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if gameRequest, ok := readGameRequest(w, r, lobby); ok {
+		writeGameResponse(w, lobby.Match(gameRequest))
+	}
+}
+
+// readGameRequest decodes and validates the game request of r and sets
+// the player from its token, or a new anonymous player if it has none.
+// Writes the error and returns false if the request cannot be played.
+func readGameRequest(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) (*websocket.GameRequest, bool) {
+	if lobby.Draining() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return nil, false
+	}
 
 	gameRequest := &websocket.GameRequest{}
 	err := json.NewDecoder(r.Body).Decode(gameRequest)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, false
+	}
+	if err := gameRequest.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
 	}
 
-	playerID := gameRequest.PlayerID
-	if err := uuid.Validate(string(gameRequest.PlayerID)); err != nil {
-		playerID = websocket.GeneratePlayerID()
-		gameRequest.PlayerID = playerID
+	if token := auth.RequestToken(r); token != "" || gameRequest.Token != "" {
+		if gameRequest.Token != "" {
+			token = gameRequest.Token
+		}
+		if gameRequest.PlayerID, err = lobby.Authenticate(token); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return nil, false
+		}
+	} else {
+		gameRequest.PlayerID = websocket.GeneratePlayerID()
 	}
+	return gameRequest, true
+}
 
-	payload, err := json.Marshal(lobby.Match(gameRequest))
+func writeGameResponse(w http.ResponseWriter, response *websocket.GameResponse) {
+	payload, err := json.Marshal(response)
 	if err != nil {
 		log.Printf("error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"log"
+	"net/http"
+)
+
+// Profile is the public profile of a player
+type Profile struct {
+	Handle     string
+	Registered bool
+	Ratings    map[rating.Category]rating.Profile
+}
+
+// HandleProfile writes the ratings of the player with the handle in the path
+func HandleProfile(w http.ResponseWriter, r *http.Request, l *websocket.Lobby) {
+	handle := r.PathValue("handle")
+	account, registered := l.Accounts.Lookup(handle)
+	if registered {
+		handle = account.Username
+	}
+	payload, err := json.Marshal(Profile{
+		Handle:     handle,
+		Registered: registered,
+		Ratings:    l.Ratings.Profile(handle),
+	})
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(payload); err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"net/http"
+)
+
+// HandleSeeks writes every open seek, see websocket.SeeksHandler for
+// live updates
+func HandleSeeks(w http.ResponseWriter, l *websocket.Lobby) {
+	writeJSON(w, l.Seeks())
+}
+
+// HandleSeek posts a seek on the seek board
+func HandleSeek(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if gameRequest, ok := readGameRequest(w, r, lobby); ok {
+		writeGameResponse(w, lobby.Seek(gameRequest))
+	}
+}
+
+// HandleAccept joins the game of the seek in the path. Only the token of
+// the request body is used.
+func HandleAccept(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if gameRequest, ok := readGameRequest(w, r, lobby); ok {
+		writeGameResponse(w, lobby.Accept(gameRequest, websocket.GameID(r.PathValue("id"))))
+	}
+}
+
+// HandleChallenge creates a private game to share the link of with a
+// friend
+func HandleChallenge(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby) {
+	if gameRequest, ok := readGameRequest(w, r, lobby); ok {
+		writeGameResponse(w, lobby.Challenge(gameRequest))
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/JDRadatti/reptile/internal/auth"
+	"github.com/JDRadatti/reptile/internal/tournament"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"net/http"
+	"time"
+)
+
+// TournamentRequest is sent from the client to create a tournament. The
+// games are set like a GameRequest, Color and the rating range are not
+// used.
+type TournamentRequest struct {
+	websocket.GameRequest
+	Kind    string // tournament.ARENA, SWISS, ROUND_ROBIN or KNOCKOUT
+	Name    string
+	Starts  time.Time // now if zero
+	Minutes int       // how long an arena lasts
+	Berserk bool      // arena players can halve their clock for an extra point
+
+	Rounds       int // rounds of a swiss
+	BreakSeconds int `json:",omitempty"` // time between rounds, and between the games of a knockout match
+
+	Cycles   int              `json:",omitempty"` // times round robin players meet, once if 0
+	Games    int              `json:",omitempty"` // games of a knockout match, 1 if 0
+	Playoffs []PlayoffRequest `json:",omitempty"` // mini-matches played in order while a knockout match is tied
+}
+
+// PlayoffRequest is a mini-match of a knockout, its games have the
+// variant of the tournament
+type PlayoffRequest struct {
+	Time         int // seconds
+	Increment    int
+	Games        int  // 1 if 0
+	Armageddon   bool // a single game where a draw sends black through
+	BlackSeconds int  `json:",omitempty"` // time black starts an armageddon with, 4/5 of white's if 0
+}
+
+// HandleTournaments writes every tournament
+func HandleTournaments(w http.ResponseWriter, tournaments *tournament.Tournaments) {
+	writeJSON(w, tournaments.List())
+}
+
+// HandleCreateTournament creates a tournament, only players with an
+// account can create one
+func HandleCreateTournament(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby, tournaments *tournament.Tournaments) {
+	request := &TournamentRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := auth.RequestToken(r)
+	if request.Token != "" {
+		token = request.Token
+	}
+	pid, err := lobby.Authenticate(token)
+	if err != nil || !lobby.Accounts.Registered(string(pid)) {
+		http.Error(w, "log in to create a tournament", http.StatusUnauthorized)
+		return
+	}
+	if err := request.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var created tournament.Tournament
+	switch request.Kind {
+	case tournament.ARENA:
+		created, err = tournaments.CreateArena(tournament.ArenaOptions{
+			Name:     request.Name,
+			Game:     request.Options(),
+			Starts:   request.Starts,
+			Duration: time.Duration(request.Minutes) * time.Minute,
+			Berserk:  request.Berserk,
+		})
+	case tournament.SWISS:
+		created, err = tournaments.CreateSwiss(tournament.SwissOptions{
+			Name:   request.Name,
+			Game:   request.Options(),
+			Rounds: request.Rounds,
+			Starts: request.Starts,
+			Break:  time.Duration(request.BreakSeconds) * time.Second,
+		})
+	case tournament.ROUND_ROBIN:
+		created, err = tournaments.CreateRoundRobin(tournament.RoundRobinOptions{
+			Name:   request.Name,
+			Game:   request.Options(),
+			Cycles: request.Cycles,
+			Starts: request.Starts,
+			Break:  time.Duration(request.BreakSeconds) * time.Second,
+		})
+	case tournament.KNOCKOUT:
+		playoffs := []tournament.Playoff{}
+		for _, playoff := range request.Playoffs {
+			game := websocket.GameRequest{Time: playoff.Time, Increment: playoff.Increment, Variant: request.Variant, Rated: request.Rated}
+			playoffs = append(playoffs, tournament.Playoff{
+				Game:       game.Options(),
+				Games:      playoff.Games,
+				Armageddon: playoff.Armageddon,
+				BlackTime:  time.Duration(playoff.BlackSeconds) * time.Second,
+			})
+		}
+		created, err = tournaments.CreateKnockout(tournament.KnockoutOptions{
+			Name:     request.Name,
+			Game:     request.Options(),
+			Games:    request.Games,
+			Playoffs: playoffs,
+			Starts:   request.Starts,
+			Break:    time.Duration(request.BreakSeconds) * time.Second,
+		})
+	default:
+		http.Error(w, "unknown kind of tournament "+request.Kind, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, created.Info())
+}
+
+// HandleTournament writes the standings of the tournament in the path,
+// see tournament.StandingsHandler for live updates
+func HandleTournament(w http.ResponseWriter, r *http.Request, tournaments *tournament.Tournaments) {
+	if t, ok := getTournament(w, r, tournaments); ok {
+		writeJSON(w, tournament.Update{Action: tournament.STANDINGS, Tournament: t.Info(), Standings: t.Standings()})
+	}
+}
+
+// HandleCrosstable writes the crosstable of the tournament in the path
+func HandleCrosstable(w http.ResponseWriter, r *http.Request, tournaments *tournament.Tournaments) {
+	t, ok := getTournament(w, r, tournaments)
+	if !ok {
+		return
+	}
+	crosstabler, ok := t.(tournament.Crosstabler)
+	if !ok {
+		http.Error(w, "an arena has no crosstable", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, crosstabler.Crosstable())
+}
+
+// HandleTRF writes the results of the swiss or round robin in the path
+// as a FIDE Tournament Report File
+func HandleTRF(w http.ResponseWriter, r *http.Request, tournaments *tournament.Tournaments) {
+	t, ok := getTournament(w, r, tournaments)
+	if !ok {
+		return
+	}
+	reporter, ok := t.(tournament.Reporter)
+	if !ok {
+		http.Error(w, "only a swiss or a round robin has a report file", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.Info().ID+".trf"))
+	w.Write([]byte(reporter.TRF()))
+}
+
+// HandleJoinTournament adds the player to the tournament in the path
+func HandleJoinTournament(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby, tournaments *tournament.Tournaments) {
+	t, ok := getTournament(w, r, tournaments)
+	if !ok {
+		return
+	}
+	if pid, ok := readPlayer(w, r, lobby); ok {
+		if err := t.Join(pid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// HandleWithdraw takes the player out of the tournament in the path
+func HandleWithdraw(w http.ResponseWriter, r *http.Request, lobby *websocket.Lobby, tournaments *tournament.Tournaments) {
+	t, ok := getTournament(w, r, tournaments)
+	if !ok {
+		return
+	}
+	if pid, ok := readPlayer(w, r, lobby); ok {
+		if err := t.Withdraw(pid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// getTournament returns the tournament in the path or writes an error
+func getTournament(w http.ResponseWriter, r *http.Request, tournaments *tournament.Tournaments) (tournament.Tournament, bool) {
+	t, ok := tournaments.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "tournament not found", http.StatusNotFound)
+	}
+	return t, ok
+}
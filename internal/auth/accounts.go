@@ -0,0 +1,213 @@
+// Package auth implements player accounts and signed tokens.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	saltLength        = 16
+	keyLength         = 32
+)
+
+var iterations = 600_000 // PBKDF2-HMAC-SHA256 iterations for new passwords
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,20}$`)
+
+var (
+	ErrUsernameTaken      = errors.New("username is taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// Account is a registered player. PlayerID is the id the player has
+// in games.
+type Account struct {
+	Username   string
+	PlayerID   string
+	Created    time.Time
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+}
+
+// Accounts keeps registered accounts, saved as JSON to a file if it
+// has a path. It is safe for concurrent use.
+type Accounts struct {
+	mu        sync.Mutex
+	path      string
+	accounts  map[string]*Account // by lower case username
+	playerIDs map[string]*Account
+}
+
+// NewAccounts returns the accounts saved at path, or no accounts if the
+// file does not exist. An empty path keeps accounts in memory only.
+func NewAccounts(path string) (*Accounts, error) {
+	a := &Accounts{
+		path:      path,
+		accounts:  make(map[string]*Account),
+		playerIDs: make(map[string]*Account),
+	}
+	if path == "" {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	accounts := []*Account{}
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("reading accounts %s: %w", path, err)
+	}
+	for _, account := range accounts {
+		a.add(account)
+	}
+	return a, nil
+}
+
+func key(username string) string {
+	return strings.ToLower(username)
+}
+
+func (a *Accounts) add(account *Account) {
+	a.accounts[key(account.Username)] = account
+	a.playerIDs[account.PlayerID] = account
+}
+
+// save writes every account to a temporary file and renames it, so a
+// crash never leaves a partially written file
+func (a *Accounts) save() error {
+	if a.path == "" {
+		return nil
+	}
+	accounts := make([]*Account, 0, len(a.accounts))
+	for _, account := range a.accounts {
+		accounts = append(accounts, account)
+	}
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
+
+func hash(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, keyLength, sha256.New)
+}
+
+// ValidateCredentials returns an error if username or password cannot
+// be used for a new account
+func ValidateCredentials(username string, password string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("username must be 3 to 20 letters, digits, _ or -")
+	} else if strings.HasPrefix(key(username), AnonymousPrefix) {
+		return fmt.Errorf("username cannot start with %s", AnonymousPrefix)
+	} else if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be %d to %d characters", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// Register creates an account for username with a new player id
+func (a *Accounts) Register(username string, password string) (Account, error) {
+	if err := ValidateCredentials(username, password); err != nil {
+		return Account{}, err
+	}
+	salt := make([]byte, saltLength)
+	rand.Read(salt)
+	account := &Account{
+		Username:   username,
+		PlayerID:   uuid.NewString(),
+		Created:    time.Now().UTC(),
+		Salt:       salt,
+		Hash:       hash(password, salt, iterations),
+		Iterations: iterations,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.accounts[key(username)]; ok {
+		return Account{}, ErrUsernameTaken
+	}
+	a.add(account)
+	if err := a.save(); err != nil {
+		delete(a.accounts, key(username))
+		delete(a.playerIDs, account.PlayerID)
+		return Account{}, err
+	}
+	return *account, nil
+}
+
+// Login returns the account of username if password is correct
+func (a *Accounts) Login(username string, password string) (Account, error) {
+	a.mu.Lock()
+	account, ok := a.accounts[key(username)]
+	a.mu.Unlock()
+
+	if !ok {
+		// hash anyway so unknown usernames take as long as wrong passwords
+		hash(password, make([]byte, saltLength), iterations)
+		return Account{}, ErrInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare(hash(password, account.Salt, account.Iterations), account.Hash) != 1 {
+		return Account{}, ErrInvalidCredentials
+	}
+	return *account, nil
+}
+
+// Registered returns true if playerID belongs to an account
+func (a *Accounts) Registered(playerID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.playerIDs[playerID]
+	return ok
+}
+
+// Lookup returns the account with username
+func (a *Accounts) Lookup(username string) (Account, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if account, ok := a.accounts[key(username)]; ok {
+		return *account, true
+	}
+	return Account{}, false
+}
+
+// Get returns the account with playerID
+func (a *Accounts) Get(playerID string) (Account, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if account, ok := a.playerIDs[playerID]; ok {
+		return *account, true
+	}
+	return Account{}, false
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	iterations = 1000 // keep tests fast
+}
+
+func TestToken(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+	token := s.Sign(SESSION, "player", time.Now().Add(time.Hour))
+
+	subject, err := s.Verify(SESSION, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "player", subject)
+
+	_, err = s.Verify("other", token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = NewSigner([]byte("other secret")).Verify(SESSION, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := s.Sign(SESSION, "someone else", time.Now().Add(time.Hour))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	_, err = s.Verify(SESSION, forgedPayload+"."+signature)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = s.Verify(SESSION, payload)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = s.Verify(SESSION, s.Sign(SESSION, "player", time.Now().Add(-time.Second)))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	_, err = s.Verify(SESSION, s.Sign(SESSION, "player", time.Time{}))
+	assert.NoError(t, err)
+}
+
+func TestAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	a, err := NewAccounts(path)
+	assert.NoError(t, err)
+
+	account, err := a.Register("Magnus", "correct horse")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, account.PlayerID)
+	assert.True(t, a.Registered(account.PlayerID))
+
+	_, err = a.Register("magnus", "another password")
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	_, err = a.Register("x", "correct horse")
+	assert.Error(t, err)
+	_, err = a.Register("hikaru", "short")
+	assert.Error(t, err)
+
+	_, err = a.Login("magnus", "wrong password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = a.Login("nobody", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// accounts are loaded from the file
+	a, err = NewAccounts(path)
+	assert.NoError(t, err)
+	loggedIn, err := a.Login("magnus", "correct horse")
+	assert.NoError(t, err)
+	assert.Equal(t, account.PlayerID, loggedIn.PlayerID)
+}
+
+func TestHandle(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+	handle := s.Handle("player")
+	assert.True(t, strings.HasPrefix(handle, AnonymousPrefix))
+	assert.Equal(t, handle, s.Handle("player"))
+	assert.NotEqual(t, handle, s.Handle("other player"))
+	assert.NotEqual(t, handle, NewSigner([]byte("other secret")).Handle("player"))
+	assert.Error(t, ValidateCredentials(handle, "password"))
+}
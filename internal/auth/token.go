@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ( // token purposes, a token is only valid for the purpose it was signed for
+	SESSION = "session" // an account
+	SEAT    = "seat"    // an anonymous player
+)
+
+const (
+	CookieName      = "token"
+	SessionDuration = 30 * 24 * time.Hour
+	SeatDuration    = 30 * 24 * time.Hour
+	AnonymousPrefix = "anon-" // prefix of the handles of anonymous players
+	handleLength    = 10      // hex digits after the prefix
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("expired token")
+)
+
+var encoding = base64.RawURLEncoding
+
+type claims struct {
+	Purpose string `json:"pur"`
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"` // unix seconds, 0 if the token does not expire
+}
+
+// Signer signs and verifies tokens with HMAC-SHA256. A token is the
+// base64 encoded claims and signature separated by a dot.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a Signer using key, or a random key if key is empty.
+// Tokens signed with a random key are invalid after a restart.
+func NewSigner(key []byte) *Signer {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Signer{key: key}
+}
+
+func (s *Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Sign returns a token for subject that is valid for purpose until
+// expires, or forever if expires is the zero time
+func (s *Signer) Sign(purpose string, subject string, expires time.Time) string {
+	c := claims{Purpose: purpose, Subject: subject}
+	if !expires.IsZero() {
+		c.Expires = expires.Unix()
+	}
+	data, _ := json.Marshal(c)
+	payload := encoding.EncodeToString(data)
+	return payload + "." + encoding.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the subject of token if it was signed by s for purpose
+// and has not expired
+func (s *Signer) Verify(purpose string, token string) (string, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+	mac, err := encoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	data, err := encoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	c := claims{}
+	if err := json.Unmarshal(data, &c); err != nil || c.Purpose != purpose {
+		return "", ErrInvalidToken
+	} else if c.Expires != 0 && time.Now().Unix() >= c.Expires {
+		return "", ErrExpiredToken
+	}
+	return c.Subject, nil
+}
+
+// Handle returns the public handle of the anonymous player with the
+// secret id. Handles cannot be turned back into ids without the key.
+func (s *Signer) Handle(id string) string {
+	return AnonymousPrefix + hex.EncodeToString(s.mac("handle:" + id))[:handleLength]
+}
+
+// RequestToken returns the token of the session cookie or the bearer
+// token of the Authorization header of r
+func RequestToken(r *http.Request) string {
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return bearer
+	}
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// SessionCookie returns a cookie holding the session token
+func SessionCookie(token string) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(SessionDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// ClearCookie returns a cookie that removes the session cookie
+func ClearCookie() *http.Cookie {
+	cookie := SessionCookie("")
+	cookie.MaxAge = -1
+	return cookie
+}
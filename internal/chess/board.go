@@ -106,6 +106,13 @@ func (b *Board) Move(m string) (string, bool) {
 	b.turns++
 
 	// note: this must be after incrementing turns
+	b.finishMove(move)
+	return move.notation, true
+}
+
+// finishMove updates the check, mate and game over state after move
+// has been made and the turn incremented
+func (b *Board) finishMove(move *Move) {
 	check, mate, stale := b.checkOrMateOrStale()
 	move.check = check
 	move.mate = mate
@@ -117,25 +124,37 @@ func (b *Board) Move(m string) (string, bool) {
 	} else {
 		b.status = WHITEWIN
 	}
+	move.notation = move.toAlgebraic(b)
+}
 
-	b.moves = append(b.moves, move)
-
-	return move.toAlgebraic(b), true
+// Undo takes back the last move played, including castles.
+// Returns false if no moves have been played.
+func (b *Board) Undo() bool {
+	if len(b.moves) == 0 {
+		return false
+	}
+	b.undoMove()
+	b.turns--
+	b.gameOver = false
+	b.status = ""
+	return true
 }
 
+// undoMove reverts the last move made with makeMove.
+// It does not change the turn.
 func (b *Board) undoMove() {
 	move := b.moves[len(b.moves)-1]
 	b.moves = b.moves[:len(b.moves)-1] // pop from moves
+	move.destSquare1.piece = nil
+	if move.destSquare2 != nil { // castle
+		move.destSquare2.piece = nil
+		move.startSquare2.markUnmoved()
+		move.destSquare2.markUnmoved()
+	}
 	move.startSquare1.piece = move.piece1
 	move.startSquare2.piece = move.piece2
 	move.startSquare1.markUnmoved()
 	move.destSquare1.markUnmoved()
-	move.startSquare2.markUnmoved()
-	if move.destSquare2 != nil {
-		move.destSquare2.piece = nil
-		move.destSquare2.piece = move.piece2
-		move.destSquare2.markUnmoved()
-	}
 
 	b.updateKingSquare(move.startSquare1)
 	b.updateKingSquare(move.startSquare2)
@@ -372,7 +391,6 @@ func (b *Board) castle(start *Square, dest *Square) (string, bool) {
 	}
 
 	// clear rook
-	// TODO: undo castle
 	move := &Move{
 		startSquare1: start,
 		destSquare1:  b.squares[kingI],
@@ -386,12 +404,8 @@ func (b *Board) castle(start *Square, dest *Square) (string, bool) {
 	b.turns++
 
 	// note: this must be after incrementing turns
-	check, mate, stale := b.checkOrMateOrStale()
-	move.check = check
-	move.mate = mate
-	b.gameOver = move.mate || stale
-	b.moves = append(b.moves, move)
-	return move.toAlgebraic(b), true
+	b.finishMove(move)
+	return move.notation, true
 }
 
 func (b *Board) updateKingSquare(newKingSquare *Square) {
@@ -480,5 +494,29 @@ func (b *Board) LastMove() string {
 	if len(b.moves) == 0 {
 		return ""
 	}
-	return b.moves[len(b.moves)-1].toAlgebraic(b)
+	return b.moves[len(b.moves)-1].notation
+}
+
+// Moves returns the algebraic notation of every move played
+func (b *Board) Moves() []string {
+	moves := make([]string, len(b.moves))
+	for i, move := range b.moves {
+		moves[i] = move.notation
+	}
+	return moves
+}
+
+// Coordinates returns every move played in the f1r1f2r2 format accepted
+// by Move, so the game can be replayed on a new board
+func (b *Board) Coordinates() []string {
+	moves := make([]string, len(b.moves))
+	for i, move := range b.moves {
+		moves[i] = move.coordinates()
+	}
+	return moves
+}
+
+// Plies returns the number of half moves played
+func (b *Board) Plies() int {
+	return len(b.moves)
 }
@@ -796,3 +796,58 @@ func TestStale(t *testing.T) {
 func squaresToNotation(s1 *Square, s2 *Square) string {
 	return fmt.Sprintf("%s%s", s1.String(), s2.String())
 }
+
+// TestUndo plays moves, then undoes them one at a time and checks the
+// board matches the board before each move
+func TestUndo(t *testing.T) {
+	inputs := []struct {
+		name  string
+		moves []string
+	}{
+		{
+			name:  "captures and checks",
+			moves: []string{"e2e4", "d7d5", "e4d5", "d8d5", "b1c3", "d5e5", "d1e2", "e5e2", "f1e2"},
+		},
+		{
+			name:  "castles",
+			moves: []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "e1h1", "d7d6", "d2d3", "c8g4", "c1g5", "d8d7", "b1c3", "e8a8"},
+		},
+		{
+			name:  "checkmate",
+			moves: []string{"f2f3", "e7e5", "g2g4", "d8h4"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			board := NewBoardClassic()
+			fens := []string{}
+			for _, move := range input.moves {
+				fens = append(fens, string(board.FEN()))
+				_, ok := board.Move(move)
+				assert.True(t, ok, move)
+			}
+			assert.Equal(t, len(input.moves), board.Plies())
+
+			for i := len(input.moves) - 1; i >= 0; i-- {
+				assert.True(t, board.Undo())
+				assert.Equal(t, fens[i], string(board.FEN()), "undo %s", input.moves[i])
+				_, over := board.GameOver()
+				assert.False(t, over)
+			}
+			assert.False(t, board.Undo())
+			assert.Equal(t, WHITE, board.Turn())
+
+			// replaying after undoing everything gives the same moves,
+			// so castling rights were restored
+			notation := []string{}
+			for _, move := range input.moves {
+				n, ok := board.Move(move)
+				assert.True(t, ok, move)
+				notation = append(notation, n)
+			}
+			assert.Equal(t, notation, board.Moves())
+			assert.Equal(t, input.moves, board.Coordinates())
+		})
+	}
+}
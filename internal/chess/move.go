@@ -66,6 +66,7 @@ type Move struct {
 	check        bool
 	mate         bool
 	castle       bool
+	notation     string // algebraic notation, set once the move is played
 }
 
 // move returns the direction and step size from start to end
@@ -207,6 +208,15 @@ func (m *Move) toAlgebraic(b *Board) string {
 	return builder.String()
 }
 
+// coordinates returns the move in the format accepted by Board.Move,
+// castles are the king's square followed by the rook's square
+func (m *Move) coordinates() string {
+	if m.castle {
+		return m.startSquare1.String() + m.startSquare2.String()
+	}
+	return m.startSquare1.String() + m.destSquare1.String()
+}
+
 func validInput(file byte, rank byte) bool {
 	return 'a' <= file && file <= 'h' && '1' <= rank && rank <= '8'
 }
@@ -0,0 +1,55 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+const pgnLineLength = 80
+
+// Tag is a PGN tag pair like [Event "Casual game"]
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// PGN returns a game in Portable Game Notation with the given tags,
+// moves in algebraic notation and result. An empty result is written
+// as "*", a game in progress.
+func PGN(tags []Tag, moves []string, result string) string {
+	if result == "" {
+		result = "*"
+	}
+
+	builder := strings.Builder{}
+	for _, tag := range tags {
+		value := strings.ReplaceAll(tag.Value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `"`, `\"`)
+		builder.WriteString(fmt.Sprintf("[%s \"%s\"]\n", tag.Name, value))
+	}
+	builder.WriteString("\n")
+
+	tokens := make([]string, 0, len(moves)+len(moves)/2+1)
+	for i, move := range moves {
+		if i%2 == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d.", i/2+1))
+		}
+		tokens = append(tokens, move)
+	}
+	tokens = append(tokens, result)
+
+	lineLength := 0
+	for i, token := range tokens {
+		if i > 0 && lineLength+1+len(token) > pgnLineLength {
+			builder.WriteString("\n")
+			lineLength = 0
+		} else if i > 0 {
+			builder.WriteString(" ")
+			lineLength++
+		}
+		builder.WriteString(token)
+		lineLength += len(token)
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
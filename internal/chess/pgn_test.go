@@ -0,0 +1,36 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPGN(t *testing.T) {
+	board := NewBoardClassic()
+	for _, move := range []string{"f2f3", "e7e5", "g2g4", "d8h4"} {
+		board.Move(move)
+	}
+	status, _ := board.GameOver()
+	tags := []Tag{
+		{"Event", "Casual game"},
+		{"White", `the "fool"`},
+		{"TimeControl", "300+2"},
+	}
+
+	expected := `[Event "Casual game"]
+[White "the \"fool\""]
+[TimeControl "300+2"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+	assert.Equal(t, expected, PGN(tags, board.Moves(), status))
+	assert.Equal(t, "\n*\n", PGN(nil, nil, ""))
+
+	long := PGN(nil, strings.Split(strings.Repeat("Nf3 Nf6 Ng1 Ng8 ", 10), " ")[:40], DRAW)
+	for _, line := range strings.Split(long, "\n") {
+		assert.LessOrEqual(t, len(line), pgnLineLength)
+	}
+	assert.True(t, strings.HasSuffix(long, "20. Ng1 Ng8 1/2-1/2\n"))
+}
@@ -0,0 +1,26 @@
+package rating
+
+type Category string
+
+const ( // categories by estimated game duration
+	BULLET    Category = "bullet"
+	BLITZ     Category = "blitz"
+	RAPID     Category = "rapid"
+	CLASSICAL Category = "classical"
+)
+
+var Categories = []Category{BULLET, BLITZ, RAPID, CLASSICAL}
+
+// CategoryOf returns the category of a game estimated to last seconds
+// per player, for example the base time plus 40 times the increment
+func CategoryOf(seconds int) Category {
+	switch {
+	case seconds < 3*60:
+		return BULLET
+	case seconds < 8*60:
+		return BLITZ
+	case seconds < 25*60:
+		return RAPID
+	}
+	return CLASSICAL
+}
@@ -0,0 +1,139 @@
+// Package rating implements the Glicko-2 rating system.
+// See http://www.glicko.net/glicko/glicko2.pdf
+package rating
+
+import (
+	"math"
+)
+
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+	MinDeviation      = 45.0 // keeps ratings of very active players moving
+	tau               = 0.5  // constrains the change in volatility over time
+	scale             = 173.7178
+	epsilon           = 0.000001
+)
+
+const ( // scores
+	WIN  = 1.0
+	DRAW = 0.5
+	LOSS = 0.0
+)
+
+// Rating is a Glicko-2 rating on the Glicko scale, a new player is
+// 1500 with a deviation of 350
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// Result is the score against one opponent in a rating period
+type Result struct {
+	Opponent Rating
+	Score    float64 // WIN, DRAW or LOSS
+}
+
+func Default() Rating {
+	return Rating{
+		Rating:     DefaultRating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+// Provisional returns true if the rating is not reliable yet
+func (r Rating) Provisional() bool {
+	return r.Deviation > 110
+}
+
+func (r Rating) mu() float64 {
+	return (r.Rating - DefaultRating) / scale
+}
+
+func (r Rating) phi() float64 {
+	return r.Deviation / scale
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-g(phij)*(mu-muj)))
+}
+
+// Update returns the rating after a rating period with results. A
+// period without results only increases the deviation.
+func (r Rating) Update(results []Result) Rating {
+	mu, phi, sigma := r.mu(), r.phi(), r.Volatility
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + sigma*sigma)
+		return Rating{r.Rating, min(phi*scale, DefaultDeviation), sigma}
+	}
+
+	v, sum := 0.0, 0.0
+	for _, result := range results {
+		muj, phij := result.Opponent.mu(), result.Opponent.phi()
+		e := expected(mu, muj, phij)
+		v += g(phij) * g(phij) * e * (1 - e)
+		sum += g(phij) * (result.Score - e)
+	}
+	v = 1 / v
+	delta := v * sum
+
+	sigma = volatility(delta, phi, v, sigma)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	return Rating{
+		Rating:     mu*scale + DefaultRating,
+		Deviation:  max(min(phi*scale, DefaultDeviation), MinDeviation),
+		Volatility: sigma,
+	}
+}
+
+// volatility returns the new volatility with the Illinois algorithm
+// from step 5 of the paper
+func volatility(delta, phi, v, sigma float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// Game returns the ratings of a and b after a game where a scored score
+func Game(a Rating, b Rating, score float64) (Rating, Rating) {
+	return a.Update([]Result{{Opponent: b, Score: score}}),
+		b.Update([]Result{{Opponent: a, Score: 1 - score}})
+}
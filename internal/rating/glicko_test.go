@@ -0,0 +1,62 @@
+package rating
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	// example from the Glicko-2 paper
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: WIN},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: LOSS},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: LOSS},
+	}
+
+	updated := player.Update(results)
+	assert.InDelta(t, 1464.06, updated.Rating, 0.01)
+	assert.InDelta(t, 151.52, updated.Deviation, 0.01)
+	assert.InDelta(t, 0.05999, updated.Volatility, 0.00001)
+}
+
+func TestUpdateNoGames(t *testing.T) {
+	player := Rating{Rating: 1700, Deviation: 50, Volatility: 0.06}
+	updated := player.Update(nil)
+	assert.Equal(t, player.Rating, updated.Rating)
+	assert.Greater(t, updated.Deviation, player.Deviation)
+}
+
+func TestGame(t *testing.T) {
+	a, b := Game(Default(), Default(), WIN)
+	assert.Greater(t, a.Rating, DefaultRating)
+	assert.Less(t, b.Rating, DefaultRating)
+	assert.InDelta(t, a.Rating-DefaultRating, DefaultRating-b.Rating, 0.001)
+
+	a, b = Game(Default(), Default(), DRAW)
+	assert.InDelta(t, DefaultRating, a.Rating, 0.001)
+	assert.InDelta(t, DefaultRating, b.Rating, 0.001)
+	assert.Less(t, a.Deviation, DefaultDeviation)
+}
+
+func TestCategoryOf(t *testing.T) {
+	assert.Equal(t, BULLET, CategoryOf(60))
+	assert.Equal(t, BLITZ, CategoryOf(3*60))
+	assert.Equal(t, BLITZ, CategoryOf(5*60))
+	assert.Equal(t, RAPID, CategoryOf(10*60))
+	assert.Equal(t, CLASSICAL, CategoryOf(90*60))
+}
+
+func TestRecord(t *testing.T) {
+	r := NewRatings()
+	dw, db := r.Record(BLITZ, "a", "b", WIN)
+	assert.Greater(t, dw, 0.0)
+	assert.Less(t, db, 0.0)
+	assert.Equal(t, DefaultRating+dw, r.Get("a", BLITZ).Rating)
+	assert.Equal(t, Default(), r.Get("a", BULLET))
+
+	profile := r.Profile("a")
+	assert.Equal(t, 1, profile[BLITZ].Games)
+	assert.Equal(t, 0, profile[RAPID].Games)
+}
@@ -0,0 +1,79 @@
+package rating
+
+import (
+	"sync"
+)
+
+// Profile is a player's rating and number of rated games in a category
+type Profile struct {
+	Rating
+	Games       int
+	Provisional bool
+}
+
+// Ratings keeps the ratings of every player in every category.
+// It is safe for concurrent use.
+type Ratings struct {
+	mu      sync.Mutex
+	players map[string]map[Category]Profile
+}
+
+func NewRatings() *Ratings {
+	return &Ratings{
+		players: make(map[string]map[Category]Profile),
+	}
+}
+
+func (r *Ratings) get(player string, category Category) Profile {
+	if profile, ok := r.players[player][category]; ok {
+		return profile
+	}
+	return Profile{Rating: Default(), Provisional: true}
+}
+
+func (r *Ratings) set(player string, category Category, profile Profile) {
+	if _, ok := r.players[player]; !ok {
+		r.players[player] = make(map[Category]Profile)
+	}
+	r.players[player][category] = profile
+}
+
+// record sets the rating of player in category after a rated game
+func (r *Ratings) record(player string, category Category, rating Rating) {
+	profile := r.get(player, category)
+	profile.Rating = rating
+	profile.Games++
+	profile.Provisional = rating.Provisional()
+	r.set(player, category, profile)
+}
+
+// Get returns the rating of player in category, the default rating if
+// they have not played a rated game in it
+func (r *Ratings) Get(player string, category Category) Rating {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.get(player, category).Rating
+}
+
+// Profile returns the ratings of player in every category
+func (r *Ratings) Profile(player string) map[Category]Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	profile := make(map[Category]Profile, len(Categories))
+	for _, category := range Categories {
+		profile[category] = r.get(player, category)
+	}
+	return profile
+}
+
+// Record updates the ratings of white and black after a game in category
+// where white scored score. Returns the change in both ratings.
+func (r *Ratings) Record(category Category, white string, black string, score float64) (float64, float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, b := r.get(white, category).Rating, r.get(black, category).Rating
+	newW, newB := Game(w, b, score)
+	r.record(white, category, newW)
+	r.record(black, category, newB)
+	return newW.Rating - w.Rating, newB.Rating - b.Rating
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileStore keeps games in memory and appends every saved game to a
+// file as a line of JSON, so it needs no database. The file is read
+// back when the store is opened and a later line for the same game
+// replaces an earlier one. It is safe for concurrent use.
+type FileStore struct {
+	mu    sync.RWMutex
+	file  *os.File
+	games []*Game // sorted by newestFirst
+	ids   map[string]*Game
+}
+
+// OpenFile opens the store saved at path, creating the file if needed
+func OpenFile(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		file: file,
+		ids:  make(map[string]*Game),
+	}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("reading games %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	reader := bufio.NewReader(s.file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial last line is a write interrupted by a crash
+			if len(data) > 0 {
+				return s.truncate(data)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		g := &Game{}
+		if err := json.Unmarshal(data, g); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		s.add(g)
+	}
+}
+
+// truncate removes the partial line at the end of the file
+func (s *FileStore) truncate(partial []byte) error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	return s.file.Truncate(info.Size() - int64(len(partial)))
+}
+
+func (s *FileStore) add(g *Game) {
+	s.games = insert(s.games, g)
+	s.ids[g.ID] = g
+}
+
+func (s *FileStore) Save(g Game) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	} else if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.add(&g)
+	return nil
+}
+
+func (s *FileStore) Get(id string) (Game, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if g, ok := s.ids[id]; ok {
+		return *g, nil
+	}
+	return Game{}, ErrNotFound
+}
+
+func (s *FileStore) Find(q Query) ([]Game, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return find(s.games, q)
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
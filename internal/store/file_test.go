@@ -0,0 +1,105 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGames() []Game {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []Game{
+		{ID: "1", White: "alice", Black: "bob", Result: "1-0", Ended: day, Moves: []string{"e4", "e5"}, Clocks: []int{59000, 58000}},
+		{ID: "2", White: "bob", Black: "carol", Result: "1/2-1/2", Ended: day.Add(time.Hour)},
+		{ID: "3", White: "carol", Black: "alice", Result: "0-1", Ended: day.Add(24 * time.Hour)},
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.jsonl")
+	s, err := OpenFile(path)
+	assert.NoError(t, err)
+	for _, g := range testGames() {
+		assert.NoError(t, s.Save(g))
+	}
+
+	g, err := s.Get("1")
+	assert.NoError(t, err)
+	assert.Equal(t, testGames()[0], g)
+	_, err = s.Get("4")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	ids := func(q Query) []string {
+		games, err := s.Find(q)
+		assert.NoError(t, err)
+		ids := []string{}
+		for _, g := range games {
+			ids = append(ids, g.ID)
+		}
+		return ids
+	}
+	day := testGames()[0].Ended
+	assert.Equal(t, []string{"3", "2", "1"}, ids(Query{}))
+	assert.Equal(t, []string{"3", "1"}, ids(Query{Player: "alice"}))
+	assert.Equal(t, []string{"2"}, ids(Query{Result: "1/2-1/2"}))
+	assert.Equal(t, []string{"3", "2"}, ids(Query{Since: day.Add(time.Minute)}))
+	assert.Equal(t, []string{"2", "1"}, ids(Query{Until: day.Add(2 * time.Hour)}))
+	assert.Equal(t, []string{"3"}, ids(Query{Limit: 1}))
+
+	// games are read back from the file
+	assert.NoError(t, s.Close())
+	s, err = OpenFile(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, []string{"3", "2", "1"}, ids(Query{}))
+	g, err = s.Get("1")
+	assert.NoError(t, err)
+	assert.True(t, g.Ended.Equal(day))
+}
+
+func TestFileStorePartialWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.jsonl")
+	s, err := OpenFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Save(testGames()[0]))
+	assert.NoError(t, s.Close())
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	file.WriteString(`{"ID":"2","Wh`)
+	file.Close()
+
+	s, err = OpenFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Save(testGames()[1]))
+	assert.NoError(t, s.Close())
+
+	s, err = OpenFile(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	games, err := s.Find(Query{})
+	assert.NoError(t, err)
+	assert.Len(t, games, 2)
+}
+
+func TestFileStoreCursor(t *testing.T) {
+	s, err := OpenFile(filepath.Join(t.TempDir(), "games.jsonl"))
+	assert.NoError(t, err)
+	defer s.Close()
+	for _, g := range testGames() {
+		assert.NoError(t, s.Save(g))
+	}
+
+	page, err := s.Find(Query{Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	next, err := s.Find(Query{Limit: 2, Cursor: CursorOf(page[1])})
+	assert.NoError(t, err)
+	assert.Equal(t, []Game{testGames()[0]}, next)
+
+	_, err = s.Find(Query{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
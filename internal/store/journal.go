@@ -0,0 +1,187 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const ( // journal entry kinds
+	START    = "start"    // both players joined, has Options, Players and Tournament
+	MOVE     = "move"     // a move was played, has Move and Clocks
+	CLOCK    = "clock"    // the clocks of a running game, has Clocks
+	TAKEBACK = "takeback" // moves were taken back, has Plies and Clocks
+	BERSERK  = "berserk"  // a player went berserk, has Berserk and Clocks
+	END      = "end"      // the game is over and can be forgotten
+)
+
+// Entry is an event of an unfinished game
+type Entry struct {
+	Game    string
+	Kind    string
+	Time    time.Time
+	Options json.RawMessage `json:",omitempty"`
+	Players []string        `json:",omitempty"` // ids of white and black
+	Move    string          `json:",omitempty"` // in the format accepted by chess.Board.Move
+	Plies   int             `json:",omitempty"` // half moves left after a takeback
+	Clocks  []int           `json:",omitempty"` // milliseconds left of white and black
+
+	Tournament string `json:",omitempty"` // id of the tournament of the game
+	Berserk    []bool `json:",omitempty"` // whether white and black went berserk
+}
+
+// Journal is a write-ahead log of unfinished games. Every entry is
+// synced to disk before Append returns, so games can be rebuilt after a
+// crash. When opened, entries of finished games are dropped from the
+// file. It is safe for concurrent use.
+type Journal struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	unfinished map[string][]Entry
+	order      []string // ids of the unfinished games in the order they started
+}
+
+// OpenJournal opens the journal at path, creating it if needed
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{
+		path:       path,
+		unfinished: make(map[string][]Entry),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+// load reads the entries of unfinished games. A partial last line is a
+// write interrupted by a crash and is ignored. A corrupt line is logged
+// and skipped, along with the rest of its game if the game is known.
+func (j *Journal) load() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		entry := Entry{}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("journal %s: skipping corrupt entry: %v", j.path, err)
+			delete(j.unfinished, entry.Game)
+			continue
+		}
+		j.add(entry)
+	}
+}
+
+func (j *Journal) add(entry Entry) {
+	switch entry.Kind {
+	case START:
+		if _, ok := j.unfinished[entry.Game]; !ok {
+			j.order = append(j.order, entry.Game)
+		}
+		j.unfinished[entry.Game] = []Entry{entry}
+	case END:
+		delete(j.unfinished, entry.Game)
+	default:
+		if entries, ok := j.unfinished[entry.Game]; ok {
+			j.unfinished[entry.Game] = append(entries, entry)
+		}
+	}
+}
+
+// compact rewrites the journal with only the entries of unfinished games
+func (j *Journal) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	order := []string{}
+	for _, id := range j.order {
+		entries, ok := j.unfinished[id]
+		if !ok {
+			continue
+		}
+		order = append(order, id)
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+			writer.Write(append(data, '\n'))
+		}
+	}
+	j.order = order
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// Append writes entry to the journal and syncs it to disk
+func (j *Journal) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Unfinished returns the entries of every game that had not ended when
+// the journal was opened, in the order the games started
+func (j *Journal) Unfinished() [][]Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	games := make([][]Entry, 0, len(j.order))
+	for _, id := range j.order {
+		games = append(games, j.unfinished[id])
+	}
+	return games
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := OpenJournal(path)
+	assert.NoError(t, err)
+	entries := []Entry{
+		{Game: "1", Kind: START, Players: []string{"a", "b"}, Clocks: []int{60000, 60000}},
+		{Game: "2", Kind: START, Players: []string{"c", "d"}},
+		{Game: "1", Kind: MOVE, Move: "e2e4", Clocks: []int{59000, 60000}},
+		{Game: "2", Kind: END},
+		{Game: "3", Kind: MOVE, Move: "e2e4"}, // never started
+		{Game: "1", Kind: CLOCK, Clocks: []int{59000, 55000}},
+	}
+	for _, e := range entries {
+		assert.NoError(t, j.Append(e))
+	}
+	assert.NoError(t, j.Close())
+
+	j, err = OpenJournal(path)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Entry{{entries[0], entries[2], entries[5]}}, j.Unfinished())
+	assert.NoError(t, j.Append(Entry{Game: "1", Kind: END}))
+	assert.NoError(t, j.Close())
+
+	j, err = OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.Empty(t, j.Unfinished())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, data, "finished games are compacted away")
+}
+
+func TestJournalPartialWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := OpenJournal(path)
+	assert.NoError(t, err)
+	assert.NoError(t, j.Append(Entry{Game: "1", Kind: START}))
+	assert.NoError(t, j.Close())
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(t, err)
+	file.WriteString(`{"Game":"1","Kind":"mo`)
+	file.Close()
+
+	j, err = OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.Len(t, j.Unfinished(), 1)
+	assert.NoError(t, j.Append(Entry{Game: "1", Kind: MOVE, Move: "e2e4"}))
+	assert.Len(t, j.Unfinished()[0], 1, "entries appended after opening are not loaded")
+}
+
+func TestJournalCorruptEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	data := `{"Game":"1","Kind":"start"}
+{"Game":"2","Kind":"start"}
+not json
+{"Game":"2","Kind":"move","Clocks":"e2e4"}
+{"Game":"2","Kind":"move","Move":"e7e5"}
+{"Game":"1","Kind":"move","Move":"e2e4"}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	j, err := OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.Equal(t, [][]Entry{{
+		{Game: "1", Kind: START},
+		{Game: "1", Kind: MOVE, Move: "e2e4"},
+	}}, j.Unfinished(), "the game with a corrupt entry is dropped")
+}
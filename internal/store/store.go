@@ -0,0 +1,157 @@
+// Package store archives finished games.
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("game not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Game is a finished game. Players are public handles, never player ids.
+type Game struct {
+	ID          string
+	White       string
+	Black       string
+	TimeControl string // in the format of the PGN TimeControl tag
+	Variant     string
+	Rated       bool
+	Started     time.Time
+	Ended       time.Time
+	Result      string   // chess.WHITEWIN, chess.BLACKWIN or chess.DRAW
+	Termination string   // how the game ended, the action of the end message
+	Moves       []string // in algebraic notation
+	Coordinates []string // the moves in the format accepted by chess.Board.Move
+	Clocks      []int    // milliseconds left of the player who made each move
+	RatingDelta []int    `json:",omitempty"` // white and black rating changes of a rated game
+}
+
+// Query selects games. Empty fields match every game.
+type Query struct {
+	Player string // handle of either player
+	Result string
+	Since  time.Time // ended at or after
+	Until  time.Time // ended before
+	Limit  int       // at most this many games, 0 for all
+	Cursor string    // only games after the game of the cursor, see CursorOf
+}
+
+// Match returns true iff g is selected by q
+func (q Query) Match(g *Game) bool {
+	if q.Player != "" && g.White != q.Player && g.Black != q.Player {
+		return false
+	} else if q.Result != "" && g.Result != q.Result {
+		return false
+	} else if !q.Since.IsZero() && g.Ended.Before(q.Since) {
+		return false
+	} else if !q.Until.IsZero() && !g.Ended.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Store saves finished games and finds them again
+type Store interface {
+	// Save archives g, replacing a game with the same id
+	Save(g Game) error
+	// Get returns the game with id or ErrNotFound
+	Get(id string) (Game, error)
+	// Find returns the games matching q, most recently ended first
+	Find(q Query) ([]Game, error)
+	Close() error
+}
+
+// newestFirst orders games by the time they ended, most recent first
+func newestFirst(a, b *Game) int {
+	if c := b.Ended.Compare(a.Ended); c != 0 {
+		return c
+	}
+	if a.ID < b.ID {
+		return -1
+	} else if a.ID > b.ID {
+		return 1
+	}
+	return 0
+}
+
+// CursorOf returns a cursor to query the games after g
+func CursorOf(g Game) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(g.Ended.Format(time.RFC3339Nano) + " " + g.ID))
+}
+
+// parseCursor returns a game at the position of cursor
+func parseCursor(cursor string) (*Game, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ended, id, found := strings.Cut(string(data), " ")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	g := &Game{ID: id}
+	if g.Ended, err = time.Parse(time.RFC3339Nano, ended); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return g, nil
+}
+
+// find returns copies of the games matching q, most recent first
+func find(games []*Game, q Query) ([]Game, error) {
+	if q.Cursor != "" {
+		after, err := parseCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		i, found := slices.BinarySearchFunc(games, after, newestFirst)
+		if found {
+			i++
+		}
+		games = games[i:]
+	}
+
+	found := []Game{}
+	for _, g := range games {
+		if q.Match(g) {
+			found = append(found, *g)
+			if q.Limit > 0 && len(found) == q.Limit {
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// insert adds g to games sorted by newestFirst, replacing a game with the
+// same id
+func insert(games []*Game, g *Game) []*Game {
+	games = slices.DeleteFunc(games, func(other *Game) bool { return other.ID == g.ID })
+	i, _ := slices.BinarySearchFunc(games, g, newestFirst)
+	return slices.Insert(games, i, g)
+}
+
+// PGN returns the game in Portable Game Notation
+func (g Game) PGN() string {
+	event := "Casual game"
+	if g.Rated {
+		event = "Rated game"
+	}
+	tags := []chess.Tag{
+		{Name: "Event", Value: event},
+		{Name: "Site", Value: "reptile"},
+		{Name: "Date", Value: g.Started.Format("2006.01.02")},
+		{Name: "Round", Value: "-"},
+		{Name: "White", Value: g.White},
+		{Name: "Black", Value: g.Black},
+		{Name: "Result", Value: g.Result},
+		{Name: "TimeControl", Value: g.TimeControl},
+	}
+	return chess.PGN(tags, g.Moves, g.Result)
+}
@@ -0,0 +1,294 @@
+package tournament
+
+import (
+	"cmp"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	arenaPairingInterval = 2 * time.Second  // how often waiting players are paired
+	arenaConnectWait     = 30 * time.Second // how long paired players have to join their game
+	berserkMinPlies      = 14               // half moves a berserk win needs for the extra point
+)
+
+// ArenaOptions are the settings of an arena
+type ArenaOptions struct {
+	Name     string
+	Game     websocket.GameOptions
+	Starts   time.Time // now if zero
+	Duration time.Duration
+	Berserk  bool // players can halve their clock for an extra point
+}
+
+// Arena is a tournament of a fixed duration where players are paired
+// again as soon as their game is over. A win is worth 2 points and a
+// draw 1. After two wins in a row a player is on fire and scores double
+// until they fail to win. Winning a game of at least berserkMinPlies
+// after going berserk is worth an extra point.
+type Arena struct {
+	id      string
+	options ArenaOptions
+	lobby   *websocket.Lobby
+	ends    time.Time
+	state   string
+	players map[websocket.PlayerID]*arenaPlayer
+	updates *feed
+	mu      sync.Mutex
+}
+
+type arenaPlayer struct {
+	*entrant
+	score   int
+	streak  int      // wins in a row
+	results []string // points of each game
+	white   int      // games as white minus games as black
+	playing bool
+	last    websocket.PlayerID // last opponent
+}
+
+// CreateArena creates an arena that starts at options.Starts
+func (t *Tournaments) CreateArena(options ArenaOptions) (*Arena, error) {
+	if options.Name == "" {
+		return nil, errNoName
+	} else if options.Duration <= 0 {
+		return nil, errNoDuration
+	} else if err := options.Game.Validate(); err != nil {
+		return nil, err
+	}
+	if options.Starts.IsZero() {
+		options.Starts = time.Now()
+	}
+	a := &Arena{
+		id:      generateID(),
+		options: options,
+		lobby:   t.lobby,
+		ends:    options.Starts.Add(options.Duration),
+		state:   CREATED,
+		players: make(map[websocket.PlayerID]*arenaPlayer),
+		updates: newFeed(),
+	}
+	a.publish()
+	t.add(a.id, a)
+	go a.run(arenaPairingInterval)
+	return a, nil
+}
+
+// run pairs players every interval from the start to the end of the
+// arena
+func (a *Arena) run(interval time.Duration) {
+	start := time.NewTimer(time.Until(a.options.Starts))
+	<-start.C
+	a.mu.Lock()
+	a.state = STARTED
+	a.publish()
+	a.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	end := time.NewTimer(time.Until(a.ends))
+	for {
+		select {
+		case <-ticker.C:
+			a.pair()
+		case <-end.C:
+			a.mu.Lock()
+			a.state = FINISHED // running games still count
+			a.publish()
+			a.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (a *Arena) feed() *feed {
+	return a.updates
+}
+
+// publish sends the standings to the feed, with mu held
+func (a *Arena) publish() {
+	a.updates.publish(Update{Action: STANDINGS, Tournament: a.info(), Standings: a.standings()})
+}
+
+func (a *Arena) Info() Info {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.info()
+}
+
+func (a *Arena) info() Info {
+	return Info{
+		ID:          a.id,
+		Kind:        ARENA,
+		Name:        a.options.Name,
+		TimeControl: a.options.Game.TimeControl.String(),
+		Variant:     a.options.Game.Variant,
+		Rated:       a.options.Game.Rated,
+		State:       a.state,
+		Starts:      a.options.Starts,
+		Ends:        a.ends,
+		Players:     len(a.players),
+	}
+}
+
+// Join adds pid to the arena, or pairs them again after they withdrew
+func (a *Arena) Join(pid websocket.PlayerID) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == FINISHED {
+		return errFinished
+	}
+	if p, ok := a.players[pid]; ok {
+		p.withdrawn = false
+	} else {
+		a.players[pid] = &arenaPlayer{entrant: newEntrant(a.lobby, pid, a.options.Game)}
+	}
+	a.publish()
+	return nil
+}
+
+// Withdraw stops pairing pid, the game they are playing still counts
+func (a *Arena) Withdraw(pid websocket.PlayerID) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.players[pid]
+	if !ok {
+		return errNotJoined
+	}
+	p.withdrawn = true
+	a.publish()
+	return nil
+}
+
+func (a *Arena) Standings() []Standing {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.standings()
+}
+
+func (a *Arena) standings() []Standing {
+	standings := []Standing{}
+	for _, p := range a.players {
+		standings = append(standings, Standing{
+			Handle:    p.handle,
+			Rating:    p.rating,
+			Score:     float64(p.score),
+			Games:     len(p.results),
+			Results:   slices.Clone(p.results),
+			Fire:      p.streak >= 2,
+			Playing:   p.playing,
+			Withdrawn: p.withdrawn,
+		})
+	}
+	slices.SortFunc(standings, func(a, b Standing) int {
+		return cmp.Or(cmp.Compare(b.Rating, a.Rating), cmp.Compare(a.Handle, b.Handle))
+	})
+	rank(standings, func(a, b Standing) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return standings
+}
+
+// pair starts games between the players waiting for one, players with
+// similar scores play each other and nobody plays the same opponent
+// twice in a row unless there is no one else
+func (a *Arena) pair() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state != STARTED {
+		return
+	}
+
+	waiting := []*arenaPlayer{}
+	for _, p := range a.players {
+		if !p.playing && !p.withdrawn {
+			waiting = append(waiting, p)
+		}
+	}
+	slices.SortFunc(waiting, func(a, b *arenaPlayer) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(b.rating, a.rating), cmp.Compare(a.handle, b.handle))
+	})
+
+	paired := false
+	for len(waiting) >= 2 {
+		p := waiting[0]
+		i := 1
+		for i < len(waiting)-1 && waiting[i].id == p.last {
+			i++
+		}
+		q := waiting[i]
+		waiting = slices.Delete(waiting, i, i+1)[1:]
+
+		white, black := p, q
+		if q.white < p.white {
+			white, black = q, p
+		}
+		gid, err := a.lobby.StartGame(websocket.Pairing{
+			White:   white.id,
+			Black:   black.id,
+			Options: a.options.Game,
+			Berserk: a.options.Berserk,
+			Wait:    arenaConnectWait,
+			OnEnd:   a.gameOver,
+
+			Tournament: a.id,
+		})
+		if err != nil {
+			log.Printf("arena %s: pairing %s and %s: %v", a.id, white.handle, black.handle, err)
+			continue
+		}
+		white.white++
+		black.white--
+		white.last, black.last = black.id, white.id
+		white.playing, black.playing = true, true
+		for _, p := range []*arenaPlayer{white, black} {
+			a.lobby.Notify(p.handle, &websocket.Notification{Action: websocket.TOURNAMENT_GAME, GameID: gid, Tournament: a.id})
+		}
+		paired = true
+	}
+	if paired {
+		a.publish()
+	}
+}
+
+// gameOver scores a finished game, it is called by the game loop
+func (a *Arena) gameOver(result websocket.GameResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	players := [2]*arenaPlayer{a.players[result.White], a.players[result.Black]}
+	for i, p := range players {
+		p.playing = false
+		if !result.Joined[i] {
+			p.withdrawn = true // not paired again until they join again
+		}
+	}
+	if result.Result != "" {
+		outcomes := outcomes(result.Result)
+		for i, p := range players {
+			p.record(outcomes[i], result.Berserk[i], result.Plies)
+		}
+	}
+	a.publish()
+}
+
+// record scores a game with the outcome 1, 0.5 or 0, see Arena
+func (p *arenaPlayer) record(outcome float64, berserk bool, plies int) {
+	points := int(outcome * 2)
+	if p.streak >= 2 {
+		points *= 2
+	}
+	if berserk && outcome == 1 && plies >= berserkMinPlies {
+		points++
+	}
+	if outcome == 1 {
+		p.streak++
+	} else {
+		p.streak = 0
+	}
+	p.score += points
+	p.results = append(p.results, strconv.Itoa(points))
+}
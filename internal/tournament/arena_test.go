@@ -0,0 +1,185 @@
+package tournament
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+var blitz = websocket.GameOptions{TimeControl: websocket.FischerTimeControl(300, 0), Variant: websocket.STANDARD}
+
+// dial opens a websocket to the handler
+func dial(t *testing.T, handler *httptest.Server) *gorilla.Conn {
+	t.Helper()
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(handler.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		handler.Close()
+	})
+	return conn
+}
+
+// join connects pid to their game and returns the connection and their
+// color
+func join(t *testing.T, lobby *websocket.Lobby, gid websocket.GameID, pid websocket.PlayerID) (*gorilla.Conn, chess.Player) {
+	t.Helper()
+
+	conn := dial(t, httptest.NewServer(&websocket.WSHandler{Lobby: lobby, GameID: gid}))
+	assert.NoError(t, conn.WriteJSON(&websocket.Inbound{Action: websocket.JOIN, Token: lobby.SeatToken(pid)}))
+	out := websocket.Outbound{}
+	assert.NoError(t, conn.ReadJSON(&out))
+	assert.Equal(t, websocket.JOIN_SUCCESS, out.Action)
+	return conn, out.Player
+}
+
+// games waits until every player is in a game and returns their games
+func games(t *testing.T, lobby *websocket.Lobby, pids ...websocket.PlayerID) map[websocket.GameID][]websocket.PlayerID {
+	t.Helper()
+
+	games := make(map[websocket.GameID][]websocket.PlayerID)
+	assert.Eventually(t, func() bool {
+		clear(games)
+		for _, pid := range pids {
+			game, ok := lobby.GetGameFromPlayerID(pid)
+			if !ok {
+				return false
+			}
+			games[game.ID()] = append(games[game.ID()], pid)
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return games
+}
+
+// whiteResigns joins the players of the game, white tries to abort it
+// and then resigns
+func whiteResigns(t *testing.T, lobby *websocket.Lobby, gid websocket.GameID, pids []websocket.PlayerID) {
+	t.Helper()
+
+	conns := [2]*gorilla.Conn{}
+	for _, pid := range pids {
+		conn, color := join(t, lobby, gid, pid)
+		conns[color] = conn
+	}
+	for out := (websocket.Outbound{}); out.Action != websocket.GAME_START; {
+		assert.NoError(t, conns[chess.WHITE].ReadJSON(&out))
+	}
+	assert.NoError(t, conns[chess.WHITE].WriteJSON(&websocket.Inbound{Action: websocket.ABORT}))
+	assert.NoError(t, conns[chess.WHITE].WriteJSON(&websocket.Inbound{Action: websocket.RESIGN}))
+}
+
+// resignRound waits until two of pids play round of tournament, and white
+// resigns their game. Returns the two players.
+func resignRound(t *testing.T, lobby *websocket.Lobby, tournament Tournament, round int, pids ...websocket.PlayerID) []websocket.PlayerID {
+	t.Helper()
+
+	var playing []websocket.PlayerID
+	assert.Eventually(t, func() bool {
+		playing = nil
+		for _, pid := range pids {
+			if _, ok := lobby.GetGameFromPlayerID(pid); ok {
+				playing = append(playing, pid)
+			}
+		}
+		return len(playing) == 2 && tournament.Info().Round == round
+	}, 5*time.Second, 10*time.Millisecond)
+	for gid, pair := range games(t, lobby, playing...) {
+		whiteResigns(t, lobby, gid, pair)
+	}
+	return playing
+}
+
+func TestArena(t *testing.T) {
+	defer func(interval time.Duration) { arenaPairingInterval = interval }(arenaPairingInterval)
+	arenaPairingInterval = time.Hour // players are paired by the test
+
+	lobby := websocket.NewLobby()
+	tournaments := New(lobby)
+	_, err := tournaments.CreateArena(ArenaOptions{Game: blitz, Duration: time.Minute})
+	assert.ErrorIs(t, err, errNoName)
+	arena, err := tournaments.CreateArena(ArenaOptions{Name: "club arena", Game: blitz, Duration: time.Minute, Berserk: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Info{arena.Info()}, tournaments.List())
+
+	feed := dial(t, httptest.NewServer(&StandingsHandler{Tournament: arena}))
+	update := Update{}
+	assert.NoError(t, feed.ReadJSON(&update))
+	assert.Equal(t, STANDINGS, update.Action)
+	assert.Equal(t, "club arena", update.Tournament.Name)
+
+	pids := make([]websocket.PlayerID, 4)
+	for i := range pids {
+		pids[i] = websocket.GeneratePlayerID()
+		assert.NoError(t, arena.Join(pids[i]))
+	}
+	assert.Equal(t, 4, arena.Info().Players)
+	assert.Eventually(t, func() bool { return arena.Info().State == STARTED }, time.Second, time.Millisecond)
+	arena.pair()
+
+	// the white player of every game goes berserk and resigns
+	winners := []websocket.PlayerID{}
+	for gid, pair := range games(t, lobby, pids...) {
+		assert.Len(t, pair, 2)
+		conns := [2]*gorilla.Conn{}
+		for _, pid := range pair {
+			conn, color := join(t, lobby, gid, pid)
+			conns[color] = conn
+			if color == chess.BLACK {
+				winners = append(winners, pid)
+			}
+		}
+		for out := (websocket.Outbound{}); out.Action != websocket.GAME_START; {
+			assert.NoError(t, conns[chess.WHITE].ReadJSON(&out))
+		}
+		assert.NoError(t, conns[chess.WHITE].WriteJSON(&websocket.Inbound{Action: websocket.BERSERK}))
+		assert.NoError(t, conns[chess.WHITE].WriteJSON(&websocket.Inbound{Action: websocket.RESIGN}))
+	}
+
+	// and the winners play each other next
+	assert.Eventually(t, func() bool {
+		standings := arena.Standings()
+		return standings[2].Games == 1 && standings[3].Games == 1 && !standings[0].Playing && !standings[1].Playing
+	}, 5*time.Second, 10*time.Millisecond)
+	arena.pair()
+	for _, pair := range games(t, lobby, pids...) {
+		assert.Len(t, pair, 2)
+		assert.Equal(t, pair[0] == winners[0] || pair[0] == winners[1], pair[1] == winners[0] || pair[1] == winners[1])
+	}
+	standings := arena.Standings()
+	assert.Equal(t, []int{1, 1, 3, 3}, []int{standings[0].Rank, standings[1].Rank, standings[2].Rank, standings[3].Rank})
+	assert.Equal(t, []string{"0"}, standings[3].Results)
+
+	assert.NoError(t, arena.Withdraw(pids[0]))
+	assert.ErrorIs(t, arena.Withdraw(websocket.GeneratePlayerID()), errNotJoined)
+}
+
+func TestArenaScoring(t *testing.T) {
+	p := &arenaPlayer{}
+	for _, game := range []struct {
+		outcome float64
+		berserk bool
+		plies   int
+	}{
+		{1, false, 20},
+		{1, true, 20},
+		{1, false, 20}, // on fire
+		{0.5, true, 20},
+		{0, false, 20},
+		{1, true, berserkMinPlies - 1},
+	} {
+		p.record(game.outcome, game.berserk, game.plies)
+	}
+	assert.Equal(t, []string{"2", "3", "4", "2", "0", "2"}, p.results)
+	assert.Equal(t, 13, p.score)
+	assert.Equal(t, 1, p.streak)
+}
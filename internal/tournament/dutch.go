@@ -0,0 +1,194 @@
+package tournament
+
+import (
+	"cmp"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"slices"
+)
+
+var (
+	pairingBudget = 100000 // pairs tried before a constraint is given up
+)
+
+// preference strengths of a player for a color
+const (
+	noPreference = iota
+	mild
+	strong
+	absolute
+)
+
+// pairDutch pairs the next round of the players, ordered by score and
+// then starting rank, with the Dutch system: players are paired within
+// their score group, the top half against the bottom half, and players
+// left over float down to the next group. Each group is paired with as
+// many pairs as possible, giving players the color they prefer where
+// the order allows. Nobody plays the same opponent twice or gets a
+// second bye. Two players who must both have the same color are not
+// paired unless there is no other way.
+// Returns the pairs, white first, in board order and the player who
+// gets the bye, if any.
+func pairDutch(players []*competitor) ([][2]*competitor, *competitor) {
+	var pairs [][2]*competitor
+	var bye *competitor
+	for _, search := range []*pairing{{colors: true, unique: true}, {unique: true}, {}} {
+		search.budget = pairingBudget
+		var ok bool
+		if pairs, bye, ok = search.round(players); ok {
+			break
+		}
+	}
+
+	allocated := make([][2]*competitor, len(pairs))
+	for board, pair := range pairs {
+		allocated[board] = allocate(pair[0], pair[1], board)
+	}
+	return allocated, bye
+}
+
+// pairing is the search for the pairs of a round
+type pairing struct {
+	colors bool // keep players who both need the same color apart
+	unique bool // no player meets the same opponent or has the bye twice
+	budget int  // pairs left to try
+}
+
+// round gives the bye, if the number of players is odd, to the lowest
+// ranked player who can have it and pairs everyone else
+func (s *pairing) round(players []*competitor) ([][2]*competitor, *competitor, bool) {
+	if len(players)%2 == 0 {
+		pairs, ok := s.groups(scoreGroups(players), nil)
+		return pairs, nil, ok
+	}
+	for i := len(players) - 1; i >= 0; i-- {
+		if s.unique && players[i].hadBye() {
+			continue
+		}
+		rest := slices.Delete(slices.Clone(players), i, i+1)
+		if pairs, ok := s.groups(scoreGroups(rest), nil); ok {
+			return pairs, players[i], true
+		}
+	}
+	return nil, nil, false
+}
+
+// scoreGroups splits players, ordered by score, by score
+func scoreGroups(players []*competitor) [][]*competitor {
+	var groups [][]*competitor
+	for i, p := range players {
+		if i == 0 || p.score() != players[i-1].score() {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], p)
+	}
+	return groups
+}
+
+// groups pairs the floaters and the first score group, and the rest of
+// the groups with the players left over
+func (s *pairing) groups(groups [][]*competitor, floaters []*competitor) ([][2]*competitor, bool) {
+	if len(groups) == 0 {
+		return nil, len(floaters) == 0
+	}
+	bracket := append(slices.Clone(floaters), groups[0]...)
+	for p := len(bracket) / 2; p >= 0; p-- {
+		var pairs [][2]*competitor
+		found := s.bracket(bracket[:p], bracket[p:], nil, func(bracketPairs [][2]*competitor, left []*competitor) bool {
+			rest, ok := s.groups(groups[1:], left)
+			if ok {
+				pairs = append(bracketPairs, rest...)
+			}
+			return ok
+		})
+		if found {
+			return pairs, true
+		}
+	}
+	return nil, false
+}
+
+// bracket pairs every player of s1 with one of s2, trying first the
+// players of s2 who want the other color, in order, and calls done with
+// the pairs and the players of s2 left over until done returns true
+func (s *pairing) bracket(s1 []*competitor, s2 []*competitor, pairs [][2]*competitor, done func([][2]*competitor, []*competitor) bool) bool {
+	if len(s1) == 0 {
+		return done(slices.Clone(pairs), s2)
+	}
+	candidates := make([]int, 0, len(s2))
+	for _, preferred := range []bool{true, false} {
+		for i, opponent := range s2 {
+			if s.compatible(s1[0], opponent) && differ(s1[0], opponent) == preferred {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	for _, i := range candidates {
+		if s.budget--; s.budget < 0 {
+			return false
+		}
+		left := slices.Delete(slices.Clone(s2), i, i+1)
+		if s.bracket(s1[1:], left, append(pairs, [2]*competitor{s1[0], s2[i]}), done) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *pairing) compatible(a, b *competitor) bool {
+	if s.unique && a.met(b) {
+		return false
+	}
+	colorA, strengthA := a.preference()
+	colorB, strengthB := b.preference()
+	return !s.colors || strengthA != absolute || strengthB != absolute || colorA != colorB
+}
+
+// differ returns whether a and b can both have the color they prefer
+func differ(a, b *competitor) bool {
+	colorA, strengthA := a.preference()
+	colorB, strengthB := b.preference()
+	return colorA != colorB || strengthA == noPreference || strengthB == noPreference
+}
+
+// allocate returns a and b, the higher ranked player first, in the
+// order of their colors. The player with the stronger preference gets
+// their color, with equal preferences the colors alternate from the
+// last round they differed, or the higher ranked player gets theirs.
+// Players without any games take turns on the boards.
+func allocate(a *competitor, b *competitor, board int) [2]*competitor {
+	colorA, strengthA := a.preference()
+	colorB, strengthB := b.preference()
+	switch {
+	case strengthA == noPreference && strengthB == noPreference:
+		if board%2 == 1 {
+			return [2]*competitor{b, a}
+		}
+		return [2]*competitor{a, b}
+	case colorA != colorB && strengthA != noPreference && strengthB != noPreference:
+		return ordered(a, b, colorA)
+	case strengthB == noPreference || strengthA > strengthB:
+		return ordered(a, b, colorA)
+	case strengthA == noPreference || strengthB > strengthA:
+		return ordered(b, a, colorB)
+	}
+	for r := min(len(a.results), len(b.results)) - 1; r >= 0; r-- {
+		ca, cb := a.results[r].color, b.results[r].color
+		if ca != cb && ca != chess.INVALID_PLAYER && cb != chess.INVALID_PLAYER {
+			return ordered(a, b, cb) // a gets the color b had
+		}
+	}
+	return ordered(a, b, colorA)
+}
+
+// ordered returns the pair with p playing color
+func ordered(p *competitor, opponent *competitor, color chess.Player) [2]*competitor {
+	if color == chess.BLACK {
+		return [2]*competitor{opponent, p}
+	}
+	return [2]*competitor{p, opponent}
+}
+
+// byRank orders players by score and then starting rank
+func byRank(a, b *competitor) int {
+	return cmp.Or(cmp.Compare(b.score(), a.score()), cmp.Compare(a.number, b.number))
+}
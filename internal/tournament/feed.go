@@ -0,0 +1,126 @@
+package tournament
+
+import (
+	"encoding/json"
+	gorilla "github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	writeWait = 10 * time.Second
+	pongWait  = 60 * time.Second
+)
+
+var upgrader = gorilla.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// feed sends the standings of a tournament to its websocket connections
+type feed struct {
+	watchers map[chan Update]struct{}
+	latest   Update
+	mu       sync.Mutex
+}
+
+func newFeed() *feed {
+	return &feed{watchers: make(map[chan Update]struct{})}
+}
+
+// publish replaces the update waiting to be sent to every connection,
+// it never blocks
+func (f *feed) publish(u Update) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latest = u
+	for w := range f.watchers {
+		replace(w, u)
+	}
+}
+
+// replace replaces the update waiting in w with u
+func replace(w chan Update, u Update) {
+	select {
+	case <-w:
+	default:
+	}
+	w <- u
+}
+
+// watch returns a channel holding the latest update
+func (f *feed) watch() chan Update {
+	w := make(chan Update, 1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.watchers[w] = struct{}{}
+	replace(w, f.latest)
+	return w
+}
+
+func (f *feed) unwatch(w chan Update) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.watchers, w)
+}
+
+// StandingsHandler serves the live standings websocket of a tournament.
+// An Update is sent when the connection opens and whenever the
+// standings change.
+type StandingsHandler struct {
+	Tournament Tournament
+}
+
+func (h *StandingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	watcher := h.Tournament.feed().watch()
+	defer h.Tournament.feed().unwatch(watcher)
+
+	// read only to notice the connection closing and answer pings
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pongWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case update := <-watcher:
+			message, err := json.Marshal(update)
+			if err != nil {
+				log.Printf("error: %v", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(gorilla.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(gorilla.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
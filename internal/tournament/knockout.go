@@ -0,0 +1,460 @@
+package tournament
+
+import (
+	"cmp"
+	"errors"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"math"
+	"math/bits"
+	"slices"
+	"sync"
+	"time"
+)
+
+// KnockoutOptions are the settings of a knockout
+type KnockoutOptions struct {
+	Name     string
+	Game     websocket.GameOptions
+	Games    int           // games of a match, 1 if 0
+	Playoffs []Playoff     // played in order while a match is tied
+	Starts   time.Time     // now if zero
+	Break    time.Duration // time between the games of a match and between rounds, roundBreak if 0
+}
+
+// Playoff is a mini-match played to break the tie of a match, like two
+// rapid games or an armageddon
+type Playoff struct {
+	Game       websocket.GameOptions
+	Games      int           // games of the mini-match, 1 if 0
+	Armageddon bool          // a single game where a draw sends black through
+	BlackTime  time.Duration // time black starts an armageddon with, 4/5 of white's if 0
+}
+
+// Knockout is a tournament where the winner of each match goes through
+// to the next round and the loser is out. Players are seeded by rating,
+// the top seeds have a bye when the players do not fill the bracket.
+// Colors alternate through a match and its playoffs, the higher seed is
+// white first. A match still tied after every playoff goes to the
+// higher seed. Players who do not join a game lose it by forfeit.
+type Knockout struct {
+	id        string
+	options   KnockoutOptions
+	lobby     *websocket.Lobby
+	state     string
+	round     int
+	total     int                 // rounds of the bracket, once started
+	players   []*competitor       // in the order they joined, by seed once started
+	matches   []*match            // of the round
+	out       map[*competitor]int // round each player lost
+	games     map[websocket.GameID]*match
+	pending   int           // matches of the round not decided yet
+	roundOver chan struct{} // signaled when pending drops to 0 or the knockout stops
+	stopped   bool          // a game could not start, no more games are played
+	updates   *feed
+	mu        sync.Mutex
+}
+
+// match is a match between two players, or a bye
+type match struct {
+	players [2]*competitor // higher seed first, nil for a bye
+	stage   int            // 0 for the match, then the playoff after the stage-1th
+	played  int            // games played in the stage
+	points  [2]float64     // of the players in the stage
+	white   int            // index of the player with white in the next game
+	winner  *competitor
+}
+
+// CreateKnockout creates a knockout that starts at options.Starts
+func (t *Tournaments) CreateKnockout(options KnockoutOptions) (*Knockout, error) {
+	if options.Name == "" {
+		return nil, errNoName
+	} else if err := options.Game.Validate(); err != nil {
+		return nil, err
+	} else if options.Games < 0 {
+		return nil, errNegative
+	}
+	for _, playoff := range options.Playoffs {
+		if err := playoff.Game.Validate(); err != nil {
+			return nil, err
+		} else if playoff.Games < 0 || playoff.BlackTime < 0 {
+			return nil, errNegative
+		}
+	}
+	if options.Starts.IsZero() {
+		options.Starts = time.Now()
+	}
+	if options.Break <= 0 {
+		options.Break = roundBreak
+	}
+	k := &Knockout{
+		id:        generateID(),
+		options:   options,
+		lobby:     t.lobby,
+		state:     CREATED,
+		out:       make(map[*competitor]int),
+		games:     make(map[websocket.GameID]*match),
+		roundOver: make(chan struct{}, 1),
+		updates:   newFeed(),
+	}
+	k.publish()
+	t.add(k.id, k)
+	go k.run()
+	return k, nil
+}
+
+// run plays the rounds of the bracket from the start of the knockout.
+// The knockout is abandoned when a game cannot start or the server
+// shuts down.
+func (k *Knockout) run() {
+	if !wait(k.lobby, time.Until(k.options.Starts)) {
+		return
+	}
+	k.mu.Lock()
+	k.state = STARTED
+	number(k.players)
+	k.total = bracketRounds(len(k.players))
+	for i, seed := range seeding(1 << k.total) {
+		if i%2 == 0 {
+			k.matches = append(k.matches, &match{})
+		}
+		if seed <= len(k.players) {
+			k.matches[i/2].players[i%2] = k.players[seed-1]
+		}
+	}
+	k.publish()
+	k.mu.Unlock()
+
+	for round := 1; round <= k.total; round++ {
+		if round > 1 && !wait(k.lobby, k.options.Break) {
+			return
+		}
+		if !k.startRound() || !waitRound(k.lobby, k.roundOver) {
+			return
+		}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.stopped {
+		return
+	}
+	k.state = FINISHED
+	k.publish()
+}
+
+// bracketRounds returns the rounds of a bracket for n players
+func bracketRounds(n int) int {
+	if n < 2 {
+		return 0
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// seeding returns the seeds of a bracket of size, a power of two, in the
+// order they are paired: 1 meets size, 2 meets size-1 and the top seeds
+// only meet in the last rounds
+func seeding(size int) []int {
+	seeds := []int{1}
+	for len(seeds) < size {
+		next := make([]int, 0, 2*len(seeds))
+		for _, seed := range seeds {
+			next = append(next, seed, 2*len(seeds)+1-seed)
+		}
+		seeds = next
+	}
+	return seeds
+}
+
+func (k *Knockout) feed() *feed {
+	return k.updates
+}
+
+// publish sends the standings to the feed, with mu held
+func (k *Knockout) publish() {
+	k.updates.publish(Update{Action: STANDINGS, Tournament: k.info(), Standings: k.standings()})
+}
+
+func (k *Knockout) Info() Info {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.info()
+}
+
+func (k *Knockout) info() Info {
+	info := Info{
+		ID:          k.id,
+		Kind:        KNOCKOUT,
+		Name:        k.options.Name,
+		TimeControl: k.options.Game.TimeControl.String(),
+		Variant:     k.options.Game.Variant,
+		Rated:       k.options.Game.Rated,
+		State:       k.state,
+		Starts:      k.options.Starts,
+		Players:     len(k.players),
+
+		Round:  k.round,
+		Rounds: bracketRounds(len(k.players)),
+	}
+	if k.state != CREATED {
+		info.Rounds = k.total
+	}
+	return info
+}
+
+// Join adds pid to the knockout before it starts
+func (k *Knockout) Join(pid websocket.PlayerID) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == FINISHED {
+		return errFinished
+	}
+	if p := k.player(pid); p != nil {
+		p.withdrawn = false
+	} else if k.state == CREATED {
+		k.players = append(k.players, &competitor{entrant: newEntrant(k.lobby, pid, k.options.Game)})
+	} else {
+		return errStarted
+	}
+	k.publish()
+	return nil
+}
+
+// Withdraw forfeits the games pid has left in the knockout, the game
+// they are playing still counts
+func (k *Knockout) Withdraw(pid websocket.PlayerID) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p := k.player(pid)
+	if p == nil {
+		return errNotJoined
+	}
+	p.withdrawn = true
+	k.publish()
+	return nil
+}
+
+func (k *Knockout) player(pid websocket.PlayerID) *competitor {
+	for _, p := range k.players {
+		if p.id == pid {
+			return p
+		}
+	}
+	return nil
+}
+
+func (k *Knockout) Standings() []Standing {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.standings()
+}
+
+// standings ranks players by the round they reached, the winner first
+func (k *Knockout) standings() []Standing {
+	reached := make(map[int]int) // seed to the round they reached
+	standings := []Standing{}
+	for _, p := range k.players {
+		reached[p.number] = k.total + 1
+		if out, ok := k.out[p]; ok {
+			reached[p.number] = out
+		}
+		standings = append(standings, p.standing())
+	}
+	slices.SortFunc(standings, func(a, b Standing) int { return cmp.Compare(a.Number, b.Number) })
+	rank(standings, func(a, b Standing) int {
+		return cmp.Compare(reached[b.Number], reached[a.Number])
+	})
+	return standings
+}
+
+func (k *Knockout) Crosstable() Crosstable {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return crosstable(k.info(), k.players, k.standings())
+}
+
+// startRound plays every match of the round, the winners of the last
+// round meet in bracket order. Returns false if the knockout stopped.
+func (k *Knockout) startRound() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.stopped || k.lobby.Draining() {
+		return false
+	}
+	k.round++
+
+	if k.round > 1 {
+		matches := []*match{}
+		for i, m := range k.matches {
+			if i%2 == 0 {
+				matches = append(matches, &match{})
+			}
+			matches[i/2].players[i%2] = m.winner
+		}
+		for _, m := range matches {
+			if m.players[1].number < m.players[0].number {
+				m.players[0], m.players[1] = m.players[1], m.players[0]
+			}
+		}
+		k.matches = matches
+	}
+	k.pending = len(k.matches)
+	for _, m := range k.matches {
+		k.play(m)
+	}
+	k.publish()
+	return !k.stopped
+}
+
+// stage returns the game options and games of the stage of m, and the
+// time white and black start with in an armageddon
+func (k *Knockout) stage(m *match) (websocket.GameOptions, int, [2]time.Duration) {
+	if m.stage == 0 {
+		return k.options.Game, max(k.options.Games, 1), [2]time.Duration{}
+	}
+	playoff := k.options.Playoffs[m.stage-1]
+	if !playoff.Armageddon {
+		return playoff.Game, max(playoff.Games, 1), [2]time.Duration{}
+	}
+	white := time.Duration(playoff.Game.TimeControl.Stages[0].Time) * time.Second
+	black := playoff.BlackTime
+	if black == 0 {
+		black = white * 4 / 5
+	}
+	return playoff.Game, 1, [2]time.Duration{white, black}
+}
+
+// settle decides m if the stage is over or cannot be caught up, moving
+// to the next playoff while it is tied. Returns whether m is decided.
+func (k *Knockout) settle(m *match) bool {
+	for m.winner == nil {
+		if m.players[0] == nil || m.players[1] == nil { // a bye
+			m.winner = m.players[0]
+			if m.winner == nil {
+				m.winner = m.players[1]
+			}
+			break
+		}
+		_, games, _ := k.stage(m)
+		lead := m.points[0] - m.points[1]
+		if remaining := float64(games - m.played); math.Abs(lead) > remaining {
+			m.winner = m.players[0]
+			if lead < 0 {
+				m.winner = m.players[1]
+			}
+		} else if remaining > 0 {
+			return false
+		} else if m.stage == len(k.options.Playoffs) {
+			m.winner = m.players[0] // the higher seed
+		} else {
+			m.stage++
+			m.played, m.points = 0, [2]float64{}
+		}
+	}
+	return true
+}
+
+// play starts the next game of m, or ends m when it is decided. Games of
+// players who withdrew or are busy in another game are forfeit. When a
+// game cannot start for another reason, like a shutdown, the knockout
+// stops.
+func (k *Knockout) play(m *match) {
+	for !k.settle(m) {
+		if k.stopped {
+			return
+		}
+		white, black := m.white, (m.white+1)%2
+		pair := [2]*competitor{m.players[white], m.players[black]}
+		options, _, clocks := k.stage(m)
+		pair[0].results = append(pair[0].results, roundResult{opponent: pair[1], color: chess.WHITE})
+		pair[1].results = append(pair[1].results, roundResult{opponent: pair[0], color: chess.BLACK})
+
+		pairing := websocket.Pairing{Options: options, Wait: roundConnectWait, Time: clocks, OnEnd: k.gameOver}
+		if !pair[0].withdrawn && !pair[1].withdrawn {
+			gid, err := startGame(k.lobby, k.id, pair, pairing)
+			if err == nil {
+				k.games[gid] = m
+				return
+			} else if !errors.Is(err, websocket.ErrPlayerBusy) {
+				for _, p := range pair {
+					p.results = p.results[:len(p.results)-1]
+				}
+				k.stop()
+				return
+			}
+		}
+		k.score(m, forfeit(k.lobby, pair))
+	}
+
+	loser := m.players[0]
+	if loser == m.winner {
+		loser = m.players[1]
+	}
+	if loser != nil {
+		k.out[loser] = k.round
+	}
+	if k.pending--; k.pending == 0 && !k.stopped {
+		k.roundOver <- struct{}{}
+	}
+}
+
+// gameOver scores a finished game and plays the next game of its match
+// after a break, it is called by the game loop
+func (k *Knockout) gameOver(result websocket.GameResult) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	m, ok := k.games[result.GameID]
+	if !ok {
+		return
+	}
+	delete(k.games, result.GameID)
+	k.score(m, result)
+	for _, p := range m.players {
+		if (p.id == result.White && !result.Joined[0]) || (p.id == result.Black && !result.Joined[1]) {
+			p.withdrawn = true // forfeits the rest of the match
+		}
+	}
+	if k.settle(m) {
+		k.play(m)
+	} else {
+		go func() {
+			if !wait(k.lobby, k.options.Break) {
+				return
+			}
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			k.play(m)
+			k.publish()
+		}()
+	}
+	k.publish()
+}
+
+// stop plays no more games and ends the round being played, with mu
+// held. The games being played still count.
+func (k *Knockout) stop() {
+	k.stopped = true
+	select {
+	case k.roundOver <- struct{}{}:
+	default:
+	}
+}
+
+// score records the result of the game of m being played. A draw in an
+// armageddon counts as a win for black.
+func (k *Knockout) score(m *match, result websocket.GameResult) {
+	white, black := m.white, (m.white+1)%2
+	codes, points := scores(result)
+	for i, p := range [2]*competitor{m.players[white], m.players[black]} {
+		last := &p.results[len(p.results)-1]
+		last.code, last.points = codes[i], points[i]
+	}
+
+	_, _, clocks := k.stage(m)
+	if clocks != [2]time.Duration{} && result.Result == chess.DRAW {
+		points = [2]float64{0, 1}
+	}
+	m.points[white] += points[0]
+	m.points[black] += points[1]
+	m.played++
+	m.white = black
+}
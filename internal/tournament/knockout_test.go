@@ -0,0 +1,119 @@
+package tournament
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeeding(t *testing.T) {
+	assert.Equal(t, []int{1, 8, 4, 5, 2, 7, 3, 6}, seeding(8))
+	assert.Equal(t, []int{0, 0, 1, 2, 2, 3, 3, 3, 3, 4}, []int{
+		bracketRounds(0), bracketRounds(1), bracketRounds(2), bracketRounds(3), bracketRounds(4),
+		bracketRounds(5), bracketRounds(6), bracketRounds(7), bracketRounds(8), bracketRounds(9),
+	})
+}
+
+func TestKnockoutPlayoffs(t *testing.T) {
+	rapid := websocket.GameOptions{TimeControl: websocket.FischerTimeControl(600, 5), Variant: websocket.STANDARD}
+	k := &Knockout{options: KnockoutOptions{
+		Game:  blitz,
+		Games: 2,
+		Playoffs: []Playoff{
+			{Game: rapid, Games: 2},
+			{Game: blitz, Armageddon: true},
+		},
+	}}
+	players := competitors(2)
+	m := &match{players: [2]*competitor{players[0], players[1]}}
+
+	// plays a game of m with the result
+	game := func(result string) {
+		white, black := m.players[m.white], m.players[(m.white+1)%2]
+		white.results = append(white.results, roundResult{opponent: black, color: chess.WHITE})
+		black.results = append(black.results, roundResult{opponent: white, color: chess.BLACK})
+		k.score(m, websocket.GameResult{Result: result})
+	}
+
+	// both win with white
+	game(chess.WHITEWIN)
+	assert.False(t, k.settle(m))
+	game(chess.WHITEWIN)
+	assert.False(t, k.settle(m))
+	assert.Equal(t, 1, m.stage)
+
+	// the rapid games are drawn
+	options, games, _ := k.stage(m)
+	assert.Equal(t, rapid, options)
+	assert.Equal(t, 2, games)
+	game(chess.DRAW)
+	game(chess.DRAW)
+	assert.False(t, k.settle(m))
+	assert.Equal(t, 2, m.stage)
+
+	// black draws the armageddon with less time and goes through
+	_, games, clocks := k.stage(m)
+	assert.Equal(t, 1, games)
+	assert.Equal(t, [2]time.Duration{300 * time.Second, 240 * time.Second}, clocks)
+	assert.Equal(t, 0, m.white)
+	game(chess.DRAW)
+	assert.True(t, k.settle(m))
+	assert.Equal(t, players[1], m.winner)
+	assert.Equal(t, []string{"2 w 1", "2 b 0", "2 w =", "2 b =", "2 w ="}, players[0].standing().Results)
+	assert.Equal(t, 2.5, players[1].score())
+}
+
+func TestKnockoutShutdown(t *testing.T) {
+	lobby := websocket.NewLobby()
+	assert.NoError(t, lobby.Shutdown(context.Background()))
+	k := &Knockout{
+		options:   KnockoutOptions{Game: blitz},
+		lobby:     lobby,
+		out:       make(map[*competitor]int),
+		games:     make(map[websocket.GameID]*match),
+		pending:   1,
+		roundOver: make(chan struct{}, 1),
+	}
+	players := competitors(2)
+	m := &match{players: [2]*competitor{players[0], players[1]}}
+
+	// the game cannot start, nobody forfeits and the round ends
+	k.play(m)
+	assert.True(t, k.stopped)
+	assert.Nil(t, m.winner)
+	assert.Empty(t, players[0].results)
+	assert.Empty(t, players[1].results)
+	assert.Len(t, k.roundOver, 1)
+	assert.False(t, k.startRound())
+}
+
+func TestKnockout(t *testing.T) {
+	lobby := websocket.NewLobby()
+	tournaments := New(lobby)
+	_, err := tournaments.CreateKnockout(KnockoutOptions{Name: "club cup", Game: blitz, Games: -1})
+	assert.ErrorIs(t, err, errNegative)
+	cup, err := tournaments.CreateKnockout(KnockoutOptions{Name: "club cup", Game: blitz, Starts: time.Now().Add(200 * time.Millisecond), Break: time.Millisecond})
+	assert.NoError(t, err)
+
+	pids := make([]websocket.PlayerID, 3)
+	for i := range pids {
+		pids[i] = websocket.GeneratePlayerID()
+		assert.NoError(t, cup.Join(pids[i]))
+	}
+	assert.Equal(t, 2, cup.Info().Rounds)
+
+	// the top seed has a bye, and white resigns in every game
+	for round := 1; round <= 2; round++ {
+		resignRound(t, lobby, cup, round, pids...)
+	}
+	assert.Eventually(t, func() bool { return cup.Info().State == FINISHED }, 5*time.Second, 10*time.Millisecond)
+
+	standings := cup.Standings()
+	assert.Equal(t, []int{1, 2, 3}, []int{standings[0].Rank, standings[1].Rank, standings[2].Rank})
+	assert.Equal(t, []string{"2 b 1", "1 b 1"}, standings[0].Results) // the third seed won with black twice
+	assert.Len(t, cup.Crosstable().Players, 3)
+}
@@ -0,0 +1,99 @@
+package tournament
+
+import (
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"time"
+)
+
+// RoundRobinOptions are the settings of a round robin
+type RoundRobinOptions struct {
+	Name   string
+	Game   websocket.GameOptions
+	Cycles int           // times every player meets every other, once if 0
+	Starts time.Time     // now if zero
+	Break  time.Duration // time between rounds, roundBreak if 0
+}
+
+// RoundRobin is a tournament where every player meets every other,
+// paired with the Berger tables. With an odd number of players one of
+// them has no game each round. In a second cycle players meet again with
+// the other color. A win is worth a point and a draw half, ties are
+// broken by Sonneborn-Berger and then the number of wins.
+type RoundRobin struct {
+	*rounds
+	cycles int
+}
+
+// CreateRoundRobin creates a round robin that starts at options.Starts
+func (t *Tournaments) CreateRoundRobin(options RoundRobinOptions) (*RoundRobin, error) {
+	if options.Name == "" {
+		return nil, errNoName
+	} else if err := options.Game.Validate(); err != nil {
+		return nil, err
+	}
+	rr := &RoundRobin{
+		rounds: newRounds(t, ROUND_ROBIN, options.Name, options.Game, options.Starts, options.Break),
+		cycles: max(options.Cycles, 1),
+	}
+	rr.system = "Individual: Round-Robin"
+	rr.count = func(players int) int {
+		if players < 2 {
+			return 0
+		}
+		return rr.cycles * (players + players%2 - 1)
+	}
+	rr.pair = rr.pairRound
+	rr.bye = roundResult{color: chess.INVALID_PLAYER, code: trfAbsent}
+	rr.tiebreaks = []tiebreak{sonnebornBergerTiebreak, winsTiebreak}
+	rr.create(t, rr)
+	return rr, nil
+}
+
+// pairRound pairs the players of a round by starting rank, with mu held.
+// Players who withdrew lose their games by forfeit.
+func (rr *RoundRobin) pairRound(round int) ([][2]*competitor, *competitor) {
+	var bye *competitor
+	pairs := [][2]*competitor{}
+	for _, pair := range berger(len(rr.players), round, rr.cycles) {
+		if pair[0] > len(rr.players) {
+			bye = rr.players[pair[1]-1]
+		} else if pair[1] > len(rr.players) {
+			bye = rr.players[pair[0]-1]
+		} else {
+			pairs = append(pairs, [2]*competitor{rr.players[pair[0]-1], rr.players[pair[1]-1]})
+		}
+	}
+	return pairs, bye
+}
+
+// berger returns the pairs of a round, counted from 1, of a round robin
+// between n players numbered from 1, white first, from the Berger
+// tables. With an odd n the player paired with n+1 has no game. The
+// rounds of the next cycles are the same with the colors reversed.
+func berger(n int, round int, cycles int) [][2]int {
+	n += n % 2
+	if n < 2 || round < 1 || round > cycles*(n-1) {
+		return nil
+	}
+	cycle, r := (round-1)/(n-1), (round-1)%(n-1)
+
+	// n meets p, who is white in odd rounds, and the players at the same
+	// distance before and after p meet each other
+	p := r*(n/2)%(n-1) + 1
+	pairs := [][2]int{{n, p}}
+	if r%2 == 0 {
+		pairs[0] = [2]int{p, n}
+	}
+	for k := 1; k < n/2; k++ {
+		white := (p+k-1)%(n-1) + 1
+		black := (p-k-1+n-1)%(n-1) + 1
+		pairs = append(pairs, [2]int{white, black})
+	}
+	if cycle%2 == 1 {
+		for i := range pairs {
+			pairs[i][0], pairs[i][1] = pairs[i][1], pairs[i][0]
+		}
+	}
+	return pairs
+}
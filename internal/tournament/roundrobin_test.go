@@ -0,0 +1,90 @@
+package tournament
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBerger(t *testing.T) {
+	// the table of six players
+	assert.Equal(t, [][][2]int{
+		{{1, 6}, {2, 5}, {3, 4}},
+		{{6, 4}, {5, 3}, {1, 2}},
+		{{2, 6}, {3, 1}, {4, 5}},
+		{{6, 5}, {1, 4}, {2, 3}},
+		{{3, 6}, {4, 2}, {5, 1}},
+	}, [][][2]int{berger(6, 1, 1), berger(6, 2, 1), berger(6, 3, 1), berger(6, 4, 1), berger(6, 5, 1)})
+	assert.Nil(t, berger(6, 6, 1))
+
+	// everyone meets once in every cycle, with the other color the second time
+	met := make(map[[2]int]int)
+	for round := 1; round <= 2*7; round++ {
+		for _, pair := range berger(7, round, 2) {
+			met[pair]++
+		}
+	}
+	for a := 1; a <= 8; a++ {
+		for b := 1; b <= 8; b++ {
+			if a != b {
+				assert.Equal(t, 1, met[[2]int{a, b}], "%d against %d", a, b)
+			}
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	lobby := websocket.NewLobby()
+	tournaments := New(lobby)
+	rr, err := tournaments.CreateRoundRobin(RoundRobinOptions{Name: "club round robin", Game: blitz, Starts: time.Now().Add(200 * time.Millisecond), Break: time.Millisecond})
+	assert.NoError(t, err)
+
+	pids := make([]websocket.PlayerID, 3)
+	for i := range pids {
+		assert.Equal(t, []int{0, 0, 1}[i], rr.Info().Rounds, "rounds with %d players", i)
+		pids[i] = websocket.GeneratePlayerID()
+		assert.NoError(t, rr.Join(pids[i]))
+	}
+	assert.Equal(t, 3, rr.Info().Rounds)
+
+	// one player rests every round and white resigns
+	for round := 1; round <= 3; round++ {
+		resignRound(t, lobby, rr, round, pids...)
+	}
+	assert.Eventually(t, func() bool { return rr.Info().State == FINISHED }, 5*time.Second, 10*time.Millisecond)
+
+	table := rr.Crosstable()
+	assert.Len(t, table.Players, 3)
+	score := 0.0
+	for i, row := range table.Players {
+		assert.Equal(t, i+1, row.Number)
+		assert.Nil(t, row.Games[i])
+		for j, games := range row.Games {
+			if i != j {
+				assert.Len(t, games, 1)
+			}
+		}
+		score += row.Score
+	}
+	assert.Equal(t, 3.0, score)
+	assert.Contains(t, rr.TRF(), "092 Individual: Round-Robin")
+}
+
+func TestRoundRobinShutdown(t *testing.T) {
+	lobby := websocket.NewLobby()
+	tournaments := New(lobby)
+	rr, err := tournaments.CreateRoundRobin(RoundRobinOptions{Name: "club round robin", Game: blitz, Starts: time.Now().Add(50 * time.Millisecond)})
+	assert.NoError(t, err)
+	for range 2 {
+		assert.NoError(t, rr.Join(websocket.GeneratePlayerID()))
+	}
+	assert.NoError(t, lobby.Shutdown(context.Background()))
+
+	// no round is played once the server shuts down
+	assert.Never(t, func() bool { return rr.Info().State != CREATED }, 200*time.Millisecond, 10*time.Millisecond)
+	assert.False(t, rr.startRound())
+	assert.Equal(t, 0, rr.Info().Round)
+}
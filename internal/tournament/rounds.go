@@ -0,0 +1,556 @@
+package tournament
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	roundBreak       = 30 * time.Second // time between rounds
+	roundConnectWait = time.Minute      // how long paired players have to join their game
+)
+
+// TRF result codes
+const (
+	trfWin         = '1'
+	trfDraw        = '='
+	trfLoss        = '0'
+	trfForfeitWin  = '+'
+	trfForfeitLoss = '-'
+	trfBye         = 'U' // the bye given by the pairing
+	trfAbsent      = 'Z'
+)
+
+// rounds plays a tournament in rounds, like a swiss or a round robin.
+// Every game of a round starts at once and the next round is paired
+// when they are all over. A win is worth a point and a draw half.
+// Players who do not join their game lose it by forfeit and are not
+// paired again until they join again.
+type rounds struct {
+	id        string
+	kind      string
+	system    string // tournament type of the TRF
+	name      string
+	game      websocket.GameOptions
+	starts    time.Time
+	breaks    time.Duration // time between rounds
+	lobby     *websocket.Lobby
+	state     string
+	round     int
+	total     int           // rounds to play, once started
+	players   []*competitor // in the order they joined, by starting rank once started
+	games     map[websocket.GameID][2]*competitor
+	pending   int           // games of the round not over yet
+	roundOver chan struct{} // signaled when pending drops to 0
+	updates   *feed
+	mu        sync.Mutex
+
+	count     func(players int) int                           // rounds to play with the players
+	pair      func(round int) ([][2]*competitor, *competitor) // pairs of the round, white first, and the bye, with mu held
+	bye       roundResult                                     // result of the bye
+	tiebreaks []tiebreak
+}
+
+// competitor is a player of a tournament played in games against given
+// opponents
+type competitor struct {
+	*entrant
+	number  int // starting rank, by rating
+	results []roundResult
+}
+
+// roundResult is the result of a player in a round, or a game of a match
+type roundResult struct {
+	opponent *competitor  // nil for a bye or a round not played
+	color    chess.Player // chess.INVALID_PLAYER without an opponent
+	points   float64
+	code     byte // TRF result code, 0 while the game is played
+}
+
+// tiebreak breaks ties between players with the same score
+type tiebreak struct {
+	name  string
+	value func(*competitor) float64
+}
+
+var (
+	buchholzTiebreak        = tiebreak{"Buchholz", (*competitor).buchholz}
+	sonnebornBergerTiebreak = tiebreak{"Sonneborn-Berger", (*competitor).sonnebornBerger}
+	winsTiebreak            = tiebreak{"Wins", (*competitor).wins}
+)
+
+func newRounds(t *Tournaments, kind string, name string, game websocket.GameOptions, starts time.Time, breaks time.Duration) *rounds {
+	if starts.IsZero() {
+		starts = time.Now()
+	}
+	if breaks <= 0 {
+		breaks = roundBreak
+	}
+	return &rounds{
+		id:        generateID(),
+		kind:      kind,
+		name:      name,
+		game:      game,
+		starts:    starts,
+		breaks:    breaks,
+		lobby:     t.lobby,
+		state:     CREATED,
+		games:     make(map[websocket.GameID][2]*competitor),
+		roundOver: make(chan struct{}, 1),
+		updates:   newFeed(),
+	}
+}
+
+// create publishes and runs the tournament
+func (r *rounds) create(t *Tournaments, tournament Tournament) {
+	r.mu.Lock()
+	r.publish()
+	r.mu.Unlock()
+	t.add(r.id, tournament)
+	go r.run()
+}
+
+// run plays the rounds from the start of the tournament. The tournament
+// is abandoned when a round cannot be played or the server shuts down.
+func (r *rounds) run() {
+	if !wait(r.lobby, time.Until(r.starts)) {
+		return
+	}
+	r.mu.Lock()
+	r.state = STARTED
+	number(r.players)
+	r.total = r.count(len(r.players))
+	r.publish()
+	r.mu.Unlock()
+
+	for round := 1; round <= r.total; round++ {
+		if round > 1 && !wait(r.lobby, r.breaks) {
+			return
+		}
+		if !r.startRound() || !waitRound(r.lobby, r.roundOver) {
+			return
+		}
+	}
+	r.mu.Lock()
+	r.state = FINISHED
+	r.publish()
+	r.mu.Unlock()
+}
+
+// number sorts players by rating and gives them their starting rank
+func number(players []*competitor) {
+	slices.SortStableFunc(players, func(a, b *competitor) int {
+		return cmp.Or(cmp.Compare(b.rating, a.rating), cmp.Compare(a.handle, b.handle))
+	})
+	for i, p := range players {
+		p.number = i + 1
+	}
+}
+
+func (r *rounds) feed() *feed {
+	return r.updates
+}
+
+// publish sends the standings to the feed, with mu held
+func (r *rounds) publish() {
+	r.updates.publish(Update{Action: STANDINGS, Tournament: r.info(), Standings: r.standings()})
+}
+
+func (r *rounds) Info() Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.info()
+}
+
+func (r *rounds) info() Info {
+	info := Info{
+		ID:          r.id,
+		Kind:        r.kind,
+		Name:        r.name,
+		TimeControl: r.game.TimeControl.String(),
+		Variant:     r.game.Variant,
+		Rated:       r.game.Rated,
+		State:       r.state,
+		Starts:      r.starts,
+		Players:     len(r.players),
+
+		Round:  r.round,
+		Rounds: r.count(len(r.players)),
+	}
+	if r.state != CREATED {
+		info.Rounds = r.total
+	}
+	for _, t := range r.tiebreaks {
+		info.Tiebreaks = append(info.Tiebreaks, t.name)
+	}
+	return info
+}
+
+// Join adds pid to the tournament before it starts, or pairs them again
+// after they withdrew
+func (r *rounds) Join(pid websocket.PlayerID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == FINISHED {
+		return errFinished
+	}
+	if p := r.player(pid); p != nil {
+		p.withdrawn = false
+	} else if r.state == CREATED {
+		r.players = append(r.players, &competitor{entrant: newEntrant(r.lobby, pid, r.game)})
+	} else {
+		return errStarted
+	}
+	r.publish()
+	return nil
+}
+
+// Withdraw stops pairing pid, the game they are playing still counts
+func (r *rounds) Withdraw(pid websocket.PlayerID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.player(pid)
+	if p == nil {
+		return errNotJoined
+	}
+	p.withdrawn = true
+	r.publish()
+	return nil
+}
+
+func (r *rounds) player(pid websocket.PlayerID) *competitor {
+	for _, p := range r.players {
+		if p.id == pid {
+			return p
+		}
+	}
+	return nil
+}
+
+func (r *rounds) Standings() []Standing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.standings()
+}
+
+func (r *rounds) standings() []Standing {
+	standings := []Standing{}
+	for _, p := range r.players {
+		standing := p.standing()
+		for _, t := range r.tiebreaks {
+			standing.Tiebreaks = append(standing.Tiebreaks, t.value(p))
+		}
+		standings = append(standings, standing)
+	}
+	rank(standings, func(a, b Standing) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), slices.Compare(b.Tiebreaks, a.Tiebreaks))
+	})
+	return standings
+}
+
+// standing returns the standing of p but their rank and tiebreaks
+func (p *competitor) standing() Standing {
+	standing := Standing{
+		Handle:    p.handle,
+		Rating:    p.rating,
+		Score:     p.score(),
+		Withdrawn: p.withdrawn,
+		Number:    p.number,
+	}
+	for _, result := range p.results {
+		if result.opponent != nil && result.code != 0 {
+			standing.Games++
+		}
+		standing.Playing = standing.Playing || result.code == 0
+		standing.Results = append(standing.Results, result.String())
+	}
+	return standing
+}
+
+// startRound pairs the players and starts every game of the round.
+// Players left out of the pairing are absent. Returns false if the
+// games of the round cannot start, those not started are not played.
+func (r *rounds) startRound() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lobby.Draining() {
+		return false
+	}
+	r.round++
+
+	pairs, bye := r.pair(r.round)
+	if bye != nil {
+		bye.results = append(bye.results, r.bye)
+	}
+	for _, pair := range pairs {
+		pair[0].results = append(pair[0].results, roundResult{opponent: pair[1], color: chess.WHITE})
+		pair[1].results = append(pair[1].results, roundResult{opponent: pair[0], color: chess.BLACK})
+	}
+	for _, p := range r.players {
+		if len(p.results) < r.round {
+			p.results = append(p.results, roundResult{color: chess.INVALID_PLAYER, code: trfAbsent})
+		}
+	}
+
+	played := true
+	for _, pair := range pairs {
+		pairing := websocket.Pairing{Options: r.game, Wait: roundConnectWait, OnEnd: r.gameOver}
+		if !played {
+			r.notPlayed(pair)
+			continue
+		} else if pair[0].withdrawn || pair[1].withdrawn {
+			r.score(pair, forfeit(r.lobby, pair))
+			continue
+		}
+		gid, err := startGame(r.lobby, r.id, pair, pairing)
+		if errors.Is(err, websocket.ErrPlayerBusy) {
+			r.score(pair, forfeit(r.lobby, pair))
+		} else if err != nil {
+			r.notPlayed(pair)
+			played = false
+		} else {
+			r.games[gid] = pair
+			r.pending++
+		}
+	}
+	if played && r.pending == 0 {
+		r.roundOver <- struct{}{}
+	}
+	r.publish()
+	return played
+}
+
+// notPlayed records that the game of the round between pair did not
+// start, without a forfeit
+func (r *rounds) notPlayed(pair [2]*competitor) {
+	for _, p := range pair {
+		p.results[r.round-1] = roundResult{color: chess.INVALID_PLAYER, code: trfAbsent}
+	}
+}
+
+// gameOver scores a finished game, it is called by the game loop
+func (r *rounds) gameOver(result websocket.GameResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pair, ok := r.games[result.GameID]
+	if !ok {
+		return
+	}
+	delete(r.games, result.GameID)
+	r.score(pair, result)
+	for i, p := range pair {
+		if !result.Joined[i] {
+			p.withdrawn = true // not paired again until they join again
+		}
+	}
+	if r.pending--; r.pending == 0 {
+		r.roundOver <- struct{}{}
+	}
+	r.publish()
+}
+
+// score records the result of the game of the round between pair
+func (r *rounds) score(pair [2]*competitor, result websocket.GameResult) {
+	codes, points := scores(result)
+	for i, p := range pair {
+		p.results[r.round-1].code, p.results[r.round-1].points = codes[i], points[i]
+	}
+}
+
+// startGame starts the game of pairing between pair, white first, and
+// tells them where to play. Returns the error of websocket.Lobby.StartGame
+// if the game could not start.
+func startGame(lobby *websocket.Lobby, tournament string, pair [2]*competitor, pairing websocket.Pairing) (websocket.GameID, error) {
+	pairing.White, pairing.Black, pairing.Tournament = pair[0].id, pair[1].id, tournament
+	gid, err := lobby.StartGame(pairing)
+	if err != nil {
+		log.Printf("tournament %s: pairing %s and %s: %v", tournament, pair[0].handle, pair[1].handle, err)
+		return "", err
+	}
+	for _, p := range pair {
+		lobby.Notify(p.handle, &websocket.Notification{Action: websocket.TOURNAMENT_GAME, GameID: gid, Tournament: tournament})
+	}
+	return gid, nil
+}
+
+// wait waits for d, returns false if the lobby starts shutting down
+// first
+func wait(lobby *websocket.Lobby, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-lobby.ShuttingDown():
+		return false
+	}
+}
+
+// waitRound waits until roundOver is signaled, returns false if the
+// lobby starts shutting down first
+func waitRound(lobby *websocket.Lobby, roundOver <-chan struct{}) bool {
+	select {
+	case <-roundOver:
+		return true
+	case <-lobby.ShuttingDown():
+		return false
+	}
+}
+
+// forfeit returns the result of a game that could not start: players
+// who withdrew or are busy in another game lose it
+func forfeit(lobby *websocket.Lobby, pair [2]*competitor) websocket.GameResult {
+	result := websocket.GameResult{}
+	for i, p := range pair {
+		_, busy := lobby.GetGameFromPlayerID(p.id)
+		result.Joined[i] = !p.withdrawn && !busy
+	}
+	if result.Joined == [2]bool{true, true} { // the game could not start for both
+		result.Joined = [2]bool{}
+	}
+	return result
+}
+
+// scores returns the TRF codes and points of white and black. A game
+// not played is won by forfeit by the player who joined it.
+func scores(result websocket.GameResult) ([2]byte, [2]float64) {
+	codes := [2]byte{trfForfeitLoss, trfForfeitLoss}
+	points := [2]float64{}
+	switch {
+	case result.Result != "":
+		points = outcomes(result.Result)
+		for i := range codes {
+			codes[i] = resultCode(points[i])
+		}
+	case result.Joined[0] && !result.Joined[1]:
+		codes[0], points[0] = trfForfeitWin, 1
+	case result.Joined[1] && !result.Joined[0]:
+		codes[1], points[1] = trfForfeitWin, 1
+	}
+	return codes, points
+}
+
+// resultCode returns the TRF code of a game played with the points
+func resultCode(points float64) byte {
+	switch points {
+	case 1:
+		return trfWin
+	case 0.5:
+		return trfDraw
+	}
+	return trfLoss
+}
+
+func (p *competitor) score() float64 {
+	score := 0.0
+	for _, r := range p.results {
+		score += r.points
+	}
+	return score
+}
+
+// buchholz returns the sum of the scores of p's opponents
+func (p *competitor) buchholz() float64 {
+	buchholz := 0.0
+	for _, r := range p.results {
+		if r.opponent != nil {
+			buchholz += r.opponent.score()
+		}
+	}
+	return buchholz
+}
+
+// sonnebornBerger returns the scores of the opponents p beat plus half
+// the scores of those they drew
+func (p *competitor) sonnebornBerger() float64 {
+	sb := 0.0
+	for _, r := range p.results {
+		if r.opponent != nil {
+			sb += r.points * r.opponent.score()
+		}
+	}
+	return sb
+}
+
+func (p *competitor) wins() float64 {
+	wins := 0.0
+	for _, r := range p.results {
+		if r.opponent != nil && r.points == 1 {
+			wins++
+		}
+	}
+	return wins
+}
+
+// met returns whether p was paired with opponent
+func (p *competitor) met(opponent *competitor) bool {
+	return slices.ContainsFunc(p.results, func(r roundResult) bool { return r.opponent == opponent })
+}
+
+// String returns the result as in the standings: the opponent's starting
+// rank, the color and the TRF code, like "5 w 1"
+func (r roundResult) String() string {
+	if r.opponent == nil {
+		return "- " + r.cell()
+	}
+	return fmt.Sprintf("%d %s %s", r.opponent.number, []string{"w", "b"}[r.color], r.cell())
+}
+
+// cell returns the TRF code of the result, or "*" while it is played
+func (r roundResult) cell() string {
+	if r.code == 0 {
+		return "*"
+	}
+	return string(r.code)
+}
+
+// TRF exports the players and results in the FIDE Tournament Report File
+// format. Games still played have no result.
+func (r *rounds) TRF() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "012 %s\n", r.name)
+	fmt.Fprintf(b, "042 %s\n", r.starts.Format("2006/01/02"))
+	fmt.Fprintf(b, "062 %d\n", len(r.players))
+	fmt.Fprintf(b, "092 %s\n", r.system)
+	fmt.Fprintf(b, "XXR %d\n", r.info().Rounds)
+
+	ranks := make(map[int]int) // starting rank to place
+	for _, standing := range r.standings() {
+		ranks[standing.Number] = standing.Rank
+	}
+	players := slices.Clone(r.players)
+	slices.SortFunc(players, func(a, b *competitor) int { return cmp.Compare(a.number, b.number) })
+	for _, p := range players {
+		fmt.Fprintf(b, "001 %4d %1s%3s %-33.33s %4d %3s %11s %10s %4.1f %4d", p.number, "", "", p.handle, p.rating, "", "", "", p.score(), ranks[p.number])
+		for _, result := range p.results {
+			opponent, color := "0000", "-"
+			if result.opponent != nil {
+				opponent, color = fmt.Sprintf("%4d", result.opponent.number), []string{"w", "b"}[result.color]
+			}
+			code := " "
+			if result.code != 0 {
+				code = string(result.code)
+			}
+			fmt.Fprintf(b, "  %s %s %s", opponent, color, code)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (r *rounds) Crosstable() Crosstable {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return crosstable(r.info(), r.players, r.standings())
+}
@@ -0,0 +1,98 @@
+package tournament
+
+import (
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"slices"
+	"time"
+)
+
+// SwissOptions are the settings of a swiss
+type SwissOptions struct {
+	Name   string
+	Game   websocket.GameOptions
+	Rounds int
+	Starts time.Time     // now if zero
+	Break  time.Duration // time between rounds, roundBreak if 0
+}
+
+// Swiss is a tournament of a fixed number of rounds, paired with the
+// Dutch system, see pairDutch. Every game of a round starts at once and
+// the next round is paired when they are all over. A win is worth a
+// point, a draw half and the bye a point. Players who do not join their
+// game lose it by forfeit. Ties are broken by Buchholz, the sum of the
+// scores of the opponents, and then Sonneborn-Berger, the scores of the
+// opponents beaten plus half the scores of those drawn.
+type Swiss struct {
+	*rounds
+}
+
+// CreateSwiss creates a swiss that starts at options.Starts
+func (t *Tournaments) CreateSwiss(options SwissOptions) (*Swiss, error) {
+	if options.Name == "" {
+		return nil, errNoName
+	} else if options.Rounds <= 0 {
+		return nil, errNoRounds
+	} else if err := options.Game.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Swiss{newRounds(t, SWISS, options.Name, options.Game, options.Starts, options.Break)}
+	s.system = "Individual: Swiss-System (Dutch)"
+	s.count = func(int) int { return options.Rounds }
+	s.pair = s.pairRound
+	s.bye = roundResult{color: chess.INVALID_PLAYER, points: 1, code: trfBye}
+	s.tiebreaks = []tiebreak{buchholzTiebreak, sonnebornBergerTiebreak}
+	s.create(t, s)
+	return s, nil
+}
+
+// pairRound pairs the players who have not withdrawn, with mu held
+func (s *Swiss) pairRound(int) ([][2]*competitor, *competitor) {
+	active := []*competitor{}
+	for _, p := range s.players {
+		if !p.withdrawn {
+			active = append(active, p)
+		}
+	}
+	slices.SortFunc(active, byRank)
+	return pairDutch(active)
+}
+
+func (p *competitor) hadBye() bool {
+	return slices.ContainsFunc(p.results, func(r roundResult) bool { return r.code == trfBye })
+}
+
+// preference returns the color p should play next and how strongly.
+// Only games played over the board count. A player who played a color
+// twice in a row, or twice more than the other, must have the other.
+func (p *competitor) preference() (chess.Player, int) {
+	colors := []chess.Player{}
+	difference := 0 // games as white minus games as black
+	for _, r := range p.results {
+		if r.opponent == nil || r.code == trfForfeitWin || r.code == trfForfeitLoss {
+			continue
+		}
+		colors = append(colors, r.color)
+		if r.color == chess.WHITE {
+			difference++
+		} else {
+			difference--
+		}
+	}
+	n := len(colors)
+	switch {
+	case n == 0:
+		return chess.INVALID_PLAYER, noPreference
+	case difference > 1:
+		return chess.BLACK, absolute
+	case difference < -1:
+		return chess.WHITE, absolute
+	case n >= 2 && colors[n-1] == colors[n-2]:
+		return (colors[n-1] + 1) % 2, absolute
+	case difference == 1:
+		return chess.BLACK, strong
+	case difference == -1:
+		return chess.WHITE, strong
+	}
+	return (colors[n-1] + 1) % 2, mild
+}
@@ -0,0 +1,187 @@
+package tournament
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// competitors returns n players numbered by starting rank
+func competitors(n int) []*competitor {
+	players := make([]*competitor, n)
+	for i := range players {
+		players[i] = &competitor{entrant: &entrant{handle: fmt.Sprintf("p%d", i+1), rating: 2000 - i}, number: i + 1}
+	}
+	return players
+}
+
+// playRound pairs players and gives every game to the higher ranked
+// player
+func playRound(t *testing.T, players []*competitor) ([][2]*competitor, *competitor) {
+	t.Helper()
+
+	active := slices.Clone(players)
+	slices.SortFunc(active, byRank)
+	pairs, bye := pairDutch(active)
+	for _, pair := range pairs {
+		assert.False(t, pair[0].met(pair[1]), "%s and %s meet again", pair[0].handle, pair[1].handle)
+		points := [2]float64{1, 0}
+		if pair[1].number < pair[0].number {
+			points = [2]float64{0, 1}
+		}
+		pair[0].results = append(pair[0].results, roundResult{opponent: pair[1], color: chess.WHITE, points: points[0], code: resultCode(points[0])})
+		pair[1].results = append(pair[1].results, roundResult{opponent: pair[0], color: chess.BLACK, points: points[1], code: resultCode(points[1])})
+	}
+	if bye != nil {
+		assert.False(t, bye.hadBye())
+		bye.results = append(bye.results, roundResult{color: chess.INVALID_PLAYER, points: 1, code: trfBye})
+	}
+	return pairs, bye
+}
+
+func TestPairDutch(t *testing.T) {
+	players := competitors(7)
+
+	// the top half plays the bottom half, colors alternate on the boards
+	pairs, bye := playRound(t, players)
+	assert.Equal(t, players[6], bye)
+	assert.Equal(t, [][2]*competitor{
+		{players[0], players[3]},
+		{players[4], players[1]},
+		{players[2], players[5]},
+	}, pairs)
+
+	// winners play winners, and everyone gets the other color
+	pairs, bye = playRound(t, players)
+	assert.Equal(t, players[5], bye)
+	for _, pair := range pairs {
+		assert.Equal(t, pair[0].results[0].points, pair[1].results[0].points)
+		for _, p := range pair {
+			assert.NotEqual(t, p.results[0].color, p.results[1].color)
+		}
+	}
+
+	for range 4 {
+		playRound(t, players)
+	}
+	for _, p := range players {
+		white := 0
+		for _, r := range p.results {
+			if r.color == chess.WHITE {
+				white++
+			}
+		}
+		assert.LessOrEqual(t, white, 3, "%s plays white too often", p.handle)
+	}
+	assert.Equal(t, 6.0, players[0].score())
+}
+
+func TestSwissPreference(t *testing.T) {
+	p, q := competitors(2)[0], competitors(2)[1]
+	game := func(color chess.Player) roundResult {
+		return roundResult{opponent: q, color: color, code: trfDraw}
+	}
+
+	color, strength := p.preference()
+	assert.Equal(t, noPreference, strength)
+	p.results = append(p.results, game(chess.WHITE))
+	color, strength = p.preference()
+	assert.Equal(t, [2]any{chess.BLACK, strong}, [2]any{color, strength})
+	p.results = append(p.results, game(chess.BLACK))
+	color, strength = p.preference()
+	assert.Equal(t, [2]any{chess.WHITE, mild}, [2]any{color, strength})
+	p.results = append(p.results, game(chess.BLACK))
+	color, strength = p.preference()
+	assert.Equal(t, [2]any{chess.WHITE, absolute}, [2]any{color, strength})
+
+	// forfeits do not count
+	p.results = append(p.results, roundResult{opponent: q, color: chess.BLACK, code: trfForfeitWin})
+	color, strength = p.preference()
+	assert.Equal(t, [2]any{chess.WHITE, absolute}, [2]any{color, strength})
+}
+
+func TestSwissTiebreaks(t *testing.T) {
+	s := &Swiss{&rounds{
+		name:      "club swiss",
+		system:    "Individual: Swiss-System (Dutch)",
+		starts:    time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC),
+		players:   competitors(3),
+		state:     FINISHED,
+		total:     2,
+		count:     func(int) int { return 2 },
+		tiebreaks: []tiebreak{buchholzTiebreak, sonnebornBergerTiebreak},
+	}}
+	a, b, c := s.players[0], s.players[1], s.players[2]
+	a.results = []roundResult{
+		{opponent: b, color: chess.WHITE, points: 1, code: trfWin},
+		{opponent: c, color: chess.BLACK, points: 0.5, code: trfDraw},
+	}
+	b.results = []roundResult{
+		{opponent: a, color: chess.BLACK, code: trfLoss},
+		{color: chess.INVALID_PLAYER, points: 1, code: trfBye},
+	}
+	c.results = []roundResult{
+		{color: chess.INVALID_PLAYER, points: 1, code: trfBye},
+		{opponent: a, color: chess.WHITE, points: 0.5, code: trfDraw},
+	}
+
+	standings := s.standings()
+	assert.Equal(t, []string{"p1", "p3", "p2"}, []string{standings[0].Handle, standings[1].Handle, standings[2].Handle})
+	assert.Equal(t, []float64{2.5, 1.75}, standings[0].Tiebreaks)
+	assert.Equal(t, []float64{1.5, 0.75}, standings[1].Tiebreaks)
+	assert.Equal(t, []string{"2 w 1", "3 b ="}, standings[0].Results)
+
+	trf := strings.Split(s.TRF(), "\n")
+	assert.Equal(t, "012 club swiss", trf[0])
+	assert.Equal(t, "042 2024/05/01", trf[1])
+	assert.Equal(t, "XXR 2", trf[4])
+	assert.Equal(t, "001    1      p1                                2000                             1.5    1     2 w 1     3 b =", trf[5])
+	assert.Equal(t, "001    2      p2                                1999                             1.0    3     1 b 0  0000 - U", trf[6])
+	assert.Equal(t, 80, strings.Index(trf[5], " 1.5"))     // points in columns 81-84
+	assert.Equal(t, 91, strings.Index(trf[5], "   2 w 1")) // round 1 from column 92
+}
+
+func TestSwiss(t *testing.T) {
+	lobby := websocket.NewLobby()
+	tournaments := New(lobby)
+	_, err := tournaments.CreateSwiss(SwissOptions{Name: "club swiss", Game: blitz})
+	assert.ErrorIs(t, err, errNoRounds)
+	swiss, err := tournaments.CreateSwiss(SwissOptions{Name: "club swiss", Game: blitz, Rounds: 2, Starts: time.Now().Add(200 * time.Millisecond), Break: time.Millisecond})
+	assert.NoError(t, err)
+
+	pids := make([]websocket.PlayerID, 3)
+	for i := range pids {
+		pids[i] = websocket.GeneratePlayerID()
+		assert.NoError(t, swiss.Join(pids[i]))
+	}
+	assert.Eventually(t, func() bool { return swiss.Info().State == STARTED }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, swiss.Join(websocket.GeneratePlayerID()), errStarted)
+
+	// white resigns every game, the bye goes to someone else next round
+	byes := []string{}
+	for round := 1; round <= 2; round++ {
+		resignRound(t, lobby, swiss, round, pids...)
+		for _, standing := range swiss.Standings() {
+			if standing.Results[round-1] == "- U" {
+				byes = append(byes, standing.Handle)
+			}
+		}
+	}
+	assert.Eventually(t, func() bool { return swiss.Info().State == FINISHED }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, byes, 2)
+	assert.NotEqual(t, byes[0], byes[1])
+
+	score := 0.0
+	for _, standing := range swiss.Standings() {
+		assert.Len(t, standing.Results, 2)
+		score += standing.Score
+	}
+	assert.Equal(t, 4.0, score) // two games and two byes
+	assert.Contains(t, swiss.TRF(), "XXR 2")
+}
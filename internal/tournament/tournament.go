@@ -0,0 +1,247 @@
+// Package tournament runs tournaments on the games of a websocket.Lobby.
+// Tournaments are kept in memory, they do not survive a restart.
+package tournament
+
+import (
+	"cmp"
+	"errors"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/JDRadatti/reptile/internal/websocket"
+	"github.com/google/uuid"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	errStarted    = errors.New("tournament has already started")
+	errFinished   = errors.New("tournament is over")
+	errNotJoined  = errors.New("player has not joined the tournament")
+	errNoDuration = errors.New("tournament has no duration")
+	errNoName     = errors.New("tournament has no name")
+	errNoRounds   = errors.New("tournament has no rounds")
+	errNegative   = errors.New("games and times cannot be negative")
+)
+
+const ( // kinds of tournaments
+	ARENA       = "arena"
+	SWISS       = "swiss"
+	ROUND_ROBIN = "round_robin"
+	KNOCKOUT    = "knockout"
+)
+
+const ( // states of a tournament
+	CREATED  = "created"
+	STARTED  = "started"
+	FINISHED = "finished"
+)
+
+const ( // actions of the standings websocket
+	STANDINGS = "standings"
+)
+
+// Info describes a tournament
+type Info struct {
+	ID          string
+	Kind        string
+	Name        string
+	TimeControl string
+	Variant     string
+	Rated       bool
+	State       string
+	Starts      time.Time
+	Ends        time.Time `json:",omitempty"` // when an arena ends
+	Players     int
+
+	Round     int      `json:",omitempty"` // round being played
+	Rounds    int      `json:",omitempty"`
+	Tiebreaks []string `json:",omitempty"` // names of Standing.Tiebreaks
+}
+
+// Standing is the place of a player in a tournament
+type Standing struct {
+	Rank      int
+	Handle    string
+	Rating    int
+	Score     float64
+	Games     int
+	Results   []string // points or result of each game, oldest first
+	Fire      bool     `json:",omitempty"` // on a win streak in an arena
+	Playing   bool     `json:",omitempty"`
+	Withdrawn bool     `json:",omitempty"`
+
+	Number    int       `json:",omitempty"` // starting rank, by rating
+	Tiebreaks []float64 `json:",omitempty"` // see Info.Tiebreaks
+}
+
+// Update is sent on the standings websocket whenever the standings
+// change
+type Update struct {
+	Action     string // STANDINGS
+	Tournament Info
+	Standings  []Standing
+}
+
+// Crosstable is the grid of the games between the players of a
+// tournament
+type Crosstable struct {
+	Tournament Info
+	Players    []CrosstableRow // by starting rank
+}
+
+// CrosstableRow holds the games of a player against every player
+type CrosstableRow struct {
+	Number int
+	Handle string
+	Rating int
+	Score  float64
+	Rank   int
+	Games  [][]string // games against each player by starting rank, their color and TRF result code like "w1" or "b=", "*" while played
+}
+
+// Tournament is a tournament of any kind
+type Tournament interface {
+	Info() Info
+	Join(pid websocket.PlayerID) error
+	Withdraw(pid websocket.PlayerID) error
+	Standings() []Standing
+	feed() *feed
+}
+
+// Crosstabler is a tournament with a crosstable, every kind but the
+// arena
+type Crosstabler interface {
+	Crosstable() Crosstable
+}
+
+// Reporter is a tournament with a FIDE Tournament Report File, a swiss
+// or a round robin
+type Reporter interface {
+	TRF() string
+}
+
+// Tournaments keeps the tournaments played in a lobby. It is safe for
+// concurrent use.
+type Tournaments struct {
+	lobby       *websocket.Lobby
+	tournaments map[string]Tournament
+	mu          sync.RWMutex
+}
+
+func New(lobby *websocket.Lobby) *Tournaments {
+	return &Tournaments{
+		lobby:       lobby,
+		tournaments: make(map[string]Tournament),
+	}
+}
+
+func (t *Tournaments) add(id string, tournament Tournament) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tournaments[id] = tournament
+}
+
+// Get returns the tournament id
+func (t *Tournaments) Get(id string) (Tournament, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tournament, ok := t.tournaments[id]
+	return tournament, ok
+}
+
+// List returns every tournament, in the order they start
+func (t *Tournaments) List() []Info {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	infos := []Info{}
+	for _, tournament := range t.tournaments {
+		infos = append(infos, tournament.Info())
+	}
+	slices.SortFunc(infos, func(a, b Info) int {
+		return cmp.Or(a.Starts.Compare(b.Starts), cmp.Compare(a.ID, b.ID))
+	})
+	return infos
+}
+
+func generateID() string {
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		log.Printf("error %s", err)
+	}
+	return uuid.String()[:8]
+}
+
+// entrant is a player of a tournament
+type entrant struct {
+	id        websocket.PlayerID
+	handle    string
+	rating    int
+	withdrawn bool
+}
+
+func newEntrant(lobby *websocket.Lobby, pid websocket.PlayerID, options websocket.GameOptions) *entrant {
+	handle := lobby.Handle(pid)
+	category := rating.CategoryOf(options.TimeControl.Estimate())
+	return &entrant{
+		id:     pid,
+		handle: handle,
+		rating: int(lobby.Ratings.Get(handle, category).Rating),
+	}
+}
+
+// rank sorts standings, best first, and numbers them. Players with the
+// same score and tiebreaks share a rank.
+func rank(standings []Standing, compare func(a, b Standing) int) {
+	slices.SortStableFunc(standings, compare)
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && compare(standings[i-1], standings[i]) == 0 {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+}
+
+// outcomes returns the score of white and black, 1 for a win, 0.5 for a
+// draw and 0 for a loss, in a game with the result
+func outcomes(result string) [2]float64 {
+	switch result {
+	case chess.WHITEWIN:
+		return [2]float64{1, 0}
+	case chess.BLACKWIN:
+		return [2]float64{0, 1}
+	case chess.DRAW:
+		return [2]float64{0.5, 0.5}
+	}
+	return [2]float64{}
+}
+
+// crosstable returns the crosstable of players, with their standings
+func crosstable(info Info, players []*competitor, standings []Standing) Crosstable {
+	ranks := make(map[int]int) // starting rank to place
+	for _, standing := range standings {
+		ranks[standing.Number] = standing.Rank
+	}
+	table := Crosstable{Tournament: info, Players: []CrosstableRow{}}
+	for _, p := range players {
+		row := CrosstableRow{
+			Number: p.number,
+			Handle: p.handle,
+			Rating: p.rating,
+			Score:  p.score(),
+			Rank:   ranks[p.number],
+			Games:  make([][]string, len(players)),
+		}
+		for _, r := range p.results {
+			if r.opponent != nil {
+				i := r.opponent.number - 1
+				row.Games[i] = append(row.Games[i], []string{"w", "b"}[r.color]+r.cell())
+			}
+		}
+		table.Players = append(table.Players, row)
+	}
+	slices.SortFunc(table.Players, func(a, b CrosstableRow) int { return cmp.Compare(a.Number, b.Number) })
+	return table
+}
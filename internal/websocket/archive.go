@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"github.com/JDRadatti/reptile/internal/store"
+	"log"
+	"time"
+)
+
+// record returns the finished game as it is archived
+func (g *Game) record() store.Game {
+	return store.Game{
+		ID:          string(g.id),
+		White:       g.handle(g.playerIDs[whiteIndex]),
+		Black:       g.handle(g.playerIDs[blackIndex]),
+		TimeControl: g.options.TimeControl.String(),
+		Variant:     g.options.Variant,
+		Rated:       g.options.Rated,
+		Started:     g.started.UTC(),
+		Ended:       time.Now().UTC(),
+		Result:      g.result,
+		Termination: g.termination,
+		Moves:       g.board.Moves(),
+		Coordinates: g.board.Coordinates(),
+		Clocks:      g.moveClocks(),
+		RatingDelta: g.ratingDelta,
+	}
+}
+
+// moveClocks returns the milliseconds left of the player who made each
+// move
+func (g *Game) moveClocks() []int {
+	var clocks []int
+	for ply := 1; ply < len(g.times); ply++ {
+		clocks = append(clocks, g.times[ply][(ply-1)%2])
+	}
+	return clocks
+}
+
+// archive saves a finished game in the lobby's store. Games without a
+// result, like aborted games, are not kept.
+func (g *Game) archive() {
+	if g.lobby.Store == nil || g.result == "" {
+		return
+	}
+	if err := g.lobby.Store.Save(g.record()); err != nil {
+		log.Printf("error archiving game %s: %v", g.id, err)
+	}
+}
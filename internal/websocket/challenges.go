@@ -0,0 +1,213 @@
+package websocket
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	challengeTimeout = 2 * time.Minute // how long a challenge can be accepted
+	challengeLimit   = 5               // open challenges a player can send
+)
+
+var (
+	errChallengeSelf    = errors.New("players cannot challenge themselves")
+	errChallengeOffline = errors.New("player has no account and is not online")
+	errChallengeLimit   = errors.New("too many open challenges")
+	errChallengeTwice   = errors.New("player was already challenged")
+	errNoChallenge      = errors.New("challenge not found")
+	errShuttingDown     = errors.New("server is shutting down")
+)
+
+type ChallengeID string
+
+// ChallengeStatus is a challenge as sent to both players
+type ChallengeStatus struct {
+	ID          ChallengeID
+	From        string // handle of the challenger
+	To          string // handle of the challenged player
+	Rating      int    // rating of the challenger
+	TimeControl string
+	Variant     string
+	Rated       bool
+	Color       string `json:",omitempty"` // color preference of the challenger
+	Expires     time.Time
+}
+
+// challenge is a game offered to a specific player. The challenger is
+// the seek of the game created when the challenge is accepted.
+type challenge struct {
+	id      ChallengeID
+	from    PlayerID
+	to      string
+	seek    *seek
+	options GameOptions
+	color   int // seat asked for by the challenger, -1 for none
+	expires time.Time
+	timer   *time.Timer
+}
+
+func (c *challenge) status() ChallengeStatus {
+	return ChallengeStatus{
+		ID:          c.id,
+		From:        c.seek.handle,
+		To:          c.to,
+		Rating:      c.seek.rating,
+		TimeControl: c.options.TimeControl.String(),
+		Variant:     c.options.Variant,
+		Rated:       c.options.Rated,
+		Color:       c.seek.color,
+		Expires:     c.expires,
+	}
+}
+
+// ChallengePlayer challenges the player with handle to the game of
+// request. They are notified on every open connection and can accept
+// or decline until the challenge expires after challengeTimeout. Only
+// players with an account or an open connection can be challenged.
+func (l *Lobby) ChallengePlayer(request *GameRequest, handle string) (ChallengeStatus, error) {
+	if l.Draining() {
+		return ChallengeStatus{}, errShuttingDown
+	}
+	if account, ok := l.Accounts.Lookup(handle); ok {
+		handle = account.Username
+	} else if !l.online(handle) {
+		return ChallengeStatus{}, errChallengeOffline
+	}
+	options := request.Options()
+	c := &challenge{
+		id:      ChallengeID(generateGameID()),
+		from:    request.PlayerID,
+		to:      handle,
+		seek:    l.newSeek(request, options),
+		options: options,
+		color:   request.colorIndex(),
+		expires: time.Now().Add(challengeTimeout),
+	}
+	if c.seek.handle == handle {
+		return ChallengeStatus{}, errChallengeSelf
+	}
+
+	l.mu.Lock()
+	open := 0
+	for _, other := range l.challenges {
+		if other.from != c.from {
+			continue
+		} else if other.to == handle {
+			l.mu.Unlock()
+			return ChallengeStatus{}, errChallengeTwice
+		}
+		open++
+	}
+	if open >= challengeLimit {
+		l.mu.Unlock()
+		return ChallengeStatus{}, errChallengeLimit
+	}
+	l.challenges[c.id] = c
+	c.timer = time.AfterFunc(challengeTimeout, func() {
+		l.endChallenge(c.id, CHALLENGE_EXPIRE, func(*challenge) bool { return true })
+	})
+	l.mu.Unlock()
+
+	status := c.status()
+	l.Notify(handle, &Notification{Action: CHALLENGE, Challenge: &status})
+	return status, nil
+}
+
+// Challenges returns the open challenges sent and received by pid,
+// oldest first
+func (l *Lobby) Challenges(pid PlayerID) []ChallengeStatus {
+	handle := l.Handle(pid)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	challenges := []ChallengeStatus{}
+	for _, c := range l.challenges {
+		if c.from == pid || c.to == handle {
+			challenges = append(challenges, c.status())
+		}
+	}
+	slices.SortFunc(challenges, func(a, b ChallengeStatus) int {
+		return cmp.Or(a.Expires.Compare(b.Expires), cmp.Compare(a.ID, b.ID))
+	})
+	return challenges
+}
+
+// AcceptChallenge starts the game of the challenge id sent to the player
+// of request, the challenger is notified with the id of the game. Only
+// the player and color of request are used, the color the challenger
+// asked for comes first.
+func (l *Lobby) AcceptChallenge(request *GameRequest, id ChallengeID) *GameResponse {
+	if l.Draining() {
+		return l.Fail()
+	}
+	handle := l.Handle(request.PlayerID)
+
+	l.mu.Lock()
+	c, ok := l.challenges[id]
+	if !ok || c.to != handle {
+		l.mu.Unlock()
+		return l.Fail()
+	}
+	_, busy := l.players[c.from]
+	if _, ok := l.players[request.PlayerID]; ok || busy {
+		l.mu.Unlock()
+		return l.Fail()
+	}
+	delete(l.challenges, id)
+	c.timer.Stop()
+	game := NewGame(l, c.options)
+	c.seek.game = game
+	l.join(c.from, game)
+	l.join(request.PlayerID, game)
+	l.mu.Unlock()
+
+	if l.seat(c.from, game, c.color, c.seek.color).GameID == "" {
+		l.leave(request.PlayerID, game)
+		return l.Fail()
+	}
+	taker := l.newSeek(request, c.options)
+	response := l.seat(request.PlayerID, game, l.takerColor(c.seek, taker), taker.color)
+	if response.GameID != "" {
+		status := c.status()
+		l.Notify(status.From, &Notification{Action: CHALLENGE_ACCEPT, GameID: game.id, Challenge: &status})
+	}
+	return response
+}
+
+// DeclineChallenge declines the challenge id sent to pid
+func (l *Lobby) DeclineChallenge(pid PlayerID, id ChallengeID) error {
+	handle := l.Handle(pid)
+	return l.endChallenge(id, CHALLENGE_DECLINE, func(c *challenge) bool {
+		return c.to == handle
+	})
+}
+
+// CancelChallenge takes back the challenge id sent by pid
+func (l *Lobby) CancelChallenge(pid PlayerID, id ChallengeID) error {
+	return l.endChallenge(id, CHALLENGE_CANCEL, func(c *challenge) bool {
+		return c.from == pid
+	})
+}
+
+// endChallenge removes the challenge id if allowed returns true, and
+// notifies both players with action
+func (l *Lobby) endChallenge(id ChallengeID, action string, allowed func(*challenge) bool) error {
+	l.mu.Lock()
+	c, ok := l.challenges[id]
+	if !ok || !allowed(c) {
+		l.mu.Unlock()
+		return errNoChallenge
+	}
+	delete(l.challenges, id)
+	c.timer.Stop()
+	l.mu.Unlock()
+
+	status := c.status()
+	note := &Notification{Action: action, Challenge: &status}
+	l.Notify(note.Challenge.From, note)
+	l.Notify(note.Challenge.To, note)
+	return nil
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// listen opens the notifications websocket of pid
+func listen(t *testing.T, l *Lobby, pid PlayerID) *websocket.Conn {
+	t.Helper()
+
+	s, conn := newWSServer(t, &NotificationsHandler{Lobby: l})
+	t.Cleanup(func() {
+		conn.Close()
+		s.Close()
+	})
+	sendMessage(t, conn, &Inbound{Token: l.SeatToken(pid)})
+	assert.Eventually(t, func() bool { return l.online(l.Handle(pid)) }, time.Second, time.Millisecond)
+	return conn
+}
+
+// receiveNotification reads messages until a notification with the
+// given action arrives
+func receiveNotification(t *testing.T, conn *websocket.Conn, action string) Notification {
+	t.Helper()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		note := Notification{}
+		if err := json.Unmarshal(message, &note); err != nil {
+			t.Fatal(err)
+		} else if note.Action == action {
+			return note
+		}
+	}
+}
+
+func TestChallengePlayer(t *testing.T) {
+	l := NewLobby()
+	challenger, friend := GeneratePlayerID(), GeneratePlayerID()
+	request := &GameRequest{PlayerID: challenger, Time: 300, Color: BLACK}
+
+	_, err := l.ChallengePlayer(request, l.Handle(friend))
+	assert.ErrorIs(t, err, errChallengeOffline)
+
+	friendConn := listen(t, l, friend)
+	challengerConn := listen(t, l, challenger)
+	_, err = l.ChallengePlayer(request, l.Handle(challenger))
+	assert.ErrorIs(t, err, errChallengeSelf)
+	status, err := l.ChallengePlayer(request, l.Handle(friend))
+	assert.NoError(t, err)
+	assert.Equal(t, l.Handle(challenger), status.From)
+	assert.Equal(t, "300", status.TimeControl)
+	_, err = l.ChallengePlayer(request, l.Handle(friend))
+	assert.ErrorIs(t, err, errChallengeTwice)
+
+	note := receiveNotification(t, friendConn, CHALLENGE)
+	assert.Equal(t, status.ID, note.Challenge.ID)
+	assert.Equal(t, []ChallengeStatus{status}, l.Challenges(friend))
+	assert.Equal(t, []ChallengeStatus{status}, l.Challenges(challenger))
+
+	// only the challenged player can accept or decline
+	assert.Equal(t, GameID(""), l.AcceptChallenge(&GameRequest{PlayerID: challenger}, status.ID).GameID)
+	assert.ErrorIs(t, l.DeclineChallenge(challenger, status.ID), errNoChallenge)
+
+	response := l.AcceptChallenge(&GameRequest{PlayerID: friend, Color: BLACK}, status.ID)
+	assert.NotEqual(t, GameID(""), response.GameID)
+	assert.Equal(t, whiteIndex, int(response.Player)) // the challenger asked first
+	note = receiveNotification(t, challengerConn, CHALLENGE_ACCEPT)
+	assert.Equal(t, response.GameID, note.GameID)
+	game, ok := l.GetGameFromPlayerID(challenger)
+	assert.True(t, ok)
+	assert.Equal(t, response.GameID, game.id)
+	assert.Empty(t, l.Challenges(friend))
+
+	// players in a game are notified on the game connection too
+	connect(t, l, response.GameID, challenger)
+	friendGame := connect(t, l, response.GameID, friend)
+	other := GeneratePlayerID()
+	status, err = l.ChallengePlayer(&GameRequest{PlayerID: other, Time: 60}, l.Handle(friend))
+	assert.NoError(t, err)
+	assert.Equal(t, status.ID, receiveNotification(t, friendGame, CHALLENGE).Challenge.ID)
+	assert.Equal(t, GameID(""), l.AcceptChallenge(&GameRequest{PlayerID: friend}, status.ID).GameID)
+
+	assert.NoError(t, l.DeclineChallenge(friend, status.ID))
+	assert.Equal(t, status.ID, receiveNotification(t, friendConn, CHALLENGE_DECLINE).Challenge.ID)
+	assert.ErrorIs(t, l.CancelChallenge(other, status.ID), errNoChallenge)
+}
+
+func TestChallengeExpire(t *testing.T) {
+	defer func(timeout time.Duration) { challengeTimeout = timeout }(challengeTimeout)
+	challengeTimeout = 50 * time.Millisecond
+
+	l := NewLobby()
+	challenger, friend := GeneratePlayerID(), GeneratePlayerID()
+	conn := listen(t, l, friend)
+
+	status, err := l.ChallengePlayer(&GameRequest{PlayerID: challenger, Time: 60}, l.Handle(friend))
+	assert.NoError(t, err)
+	assert.NoError(t, l.CancelChallenge(challenger, status.ID))
+	assert.Equal(t, status.ID, receiveNotification(t, conn, CHALLENGE_CANCEL).Challenge.ID)
+
+	status, err = l.ChallengePlayer(&GameRequest{PlayerID: challenger, Time: 60}, l.Handle(friend))
+	assert.NoError(t, err)
+	assert.Equal(t, status.ID, receiveNotification(t, conn, CHALLENGE_EXPIRE).Challenge.ID)
+	assert.Empty(t, l.Challenges(challenger))
+	assert.Equal(t, GameID(""), l.AcceptChallenge(&GameRequest{PlayerID: friend}, status.ID).GameID)
+
+	// the challenges of a player are sent when they connect
+	challengeTimeout = time.Minute
+	status, err = l.ChallengePlayer(&GameRequest{PlayerID: challenger, Time: 60}, l.Handle(friend))
+	assert.NoError(t, err)
+	assert.Equal(t, status.ID, receiveNotification(t, listen(t, l, friend), CHALLENGE).Challenge.ID)
+}
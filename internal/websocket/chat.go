@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"github.com/JDRadatti/reptile/internal/chess"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	PLAYER_ROOM    = "players"
+	SPECTATOR_ROOM = "spectators"
+)
+
+var (
+	maxChatLength    = 140 // characters
+	chatBurst        = 5   // messages allowed per participant every chatWindow
+	chatWindow       = 10 * time.Second
+	chatHistoryLimit = 100 // messages kept per room for resync
+	spectatorLimit   = 50
+)
+
+// quickMessages are canned messages players can send with CHAT_QUICK
+var quickMessages = map[string]string{
+	"gg": "Good game",
+	"gl": "Good luck",
+	"hf": "Have fun",
+	"ty": "Thank you",
+	"wp": "Well played",
+}
+
+// ChatMessage is a single message in one of the game's chat rooms.
+// Player is the color of the author, or INVALID_PLAYER for spectators.
+type ChatMessage struct {
+	Room   string
+	Player chess.Player
+	Text   string
+}
+
+// chatLimiter allows at most chatBurst messages in any chatWindow
+type chatLimiter struct {
+	sent []time.Time
+}
+
+func (c *chatLimiter) allow(now time.Time) bool {
+	cutoff := now.Add(-chatWindow)
+	i := 0
+	for i < len(c.sent) && c.sent[i].Before(cutoff) {
+		i++
+	}
+	c.sent = c.sent[i:]
+	if len(c.sent) >= chatBurst {
+		return false
+	}
+	c.sent = append(c.sent, now)
+	return true
+}
+
+// spectator is a connection watching a game. Spectators only see and
+// write to the spectator room, so they cannot talk to the players.
+type spectator struct {
+	player  *Player
+	muted   bool
+	limiter chatLimiter
+}
+
+// chatText returns the text to post for a CHAT or CHAT_QUICK request
+// and a reason if the message should be rejected.
+func chatText(in *Inbound) (string, string) {
+	if in.Action == CHAT_QUICK {
+		if text, ok := quickMessages[in.Message]; ok {
+			return text, ""
+		}
+		return "", "unknown quick message"
+	}
+
+	text := strings.TrimSpace(in.Message)
+	if text == "" {
+		return "", "empty message"
+	} else if utf8.RuneCountInString(text) > maxChatLength {
+		return "", "message too long"
+	}
+	return text, ""
+}
+
+func appendChat(room []ChatMessage, msg ChatMessage) []ChatMessage {
+	room = append(room, msg)
+	if len(room) > chatHistoryLimit {
+		room = room[len(room)-chatHistoryLimit:]
+	}
+	return room
+}
+
+func (g *Game) chatOut(action string, messages []ChatMessage) *Outbound {
+	out := g.out(action, "")
+	out.Chat = messages
+	return out
+}
+
+func (g *Game) chatFail(p *Player, reason string) {
+	out := g.out(CHAT_FAIL, p.id)
+	out.Message = reason
+	g.deliver(p, out)
+}
+
+// chatHistory sends the room history visible to p, if any
+func (g *Game) chatHistory(p *Player) {
+	room := g.playerChat
+	if p.spectator {
+		room = g.spectatorChat
+	}
+	if len(room) == 0 {
+		return
+	}
+	g.deliver(p, g.chatOut(CHAT_HISTORY, room))
+}
+
+// handleChat posts, or mutes/unmutes, the chat of the sender.
+// Player messages are only sent to the two players and spectator
+// messages only to the other spectators.
+func (g *Game) handleChat(in *Inbound) {
+	index, isPlayer := g.playerIndex(in.PlayerID)
+	watcher, isSpectator := g.spectators[in.PlayerID]
+	if !isPlayer && !isSpectator {
+		return
+	}
+
+	if in.Action == CHAT_MUTE || in.Action == CHAT_UNMUTE {
+		if isPlayer {
+			g.chatMuted[index] = in.Action == CHAT_MUTE
+		} else {
+			watcher.muted = in.Action == CHAT_MUTE
+		}
+		return
+	}
+
+	var sender *Player
+	var limiter *chatLimiter
+	if isPlayer {
+		sender, limiter = g.players[index], &g.chatLimits[index]
+	} else {
+		sender, limiter = watcher.player, &watcher.limiter
+	}
+	if sender == nil {
+		return
+	}
+
+	text, reason := chatText(in)
+	if reason != "" {
+		g.chatFail(sender, reason)
+		return
+	} else if !limiter.allow(time.Now()) {
+		g.chatFail(sender, "sending messages too quickly")
+		return
+	}
+
+	if isSpectator {
+		msg := ChatMessage{Room: SPECTATOR_ROOM, Player: chess.INVALID_PLAYER, Text: text}
+		g.spectatorChat = appendChat(g.spectatorChat, msg)
+		out := g.chatOut(CHAT, []ChatMessage{msg})
+		for _, s := range g.spectators {
+			if s == watcher || !s.muted {
+				g.deliver(s.player, out)
+			}
+		}
+		return
+	}
+
+	msg := ChatMessage{Room: PLAYER_ROOM, Player: chess.Player(index), Text: text}
+	g.playerChat = appendChat(g.playerChat, msg)
+	out := g.chatOut(CHAT, []ChatMessage{msg})
+	g.deliver(sender, out)
+	if opponent := (index + 1) % 2; !g.chatMuted[opponent] {
+		g.sendToOpponent(out, index)
+	}
+}
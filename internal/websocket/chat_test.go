@@ -0,0 +1,44 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatText(t *testing.T) {
+	inputs := []struct {
+		name   string
+		in     *Inbound
+		text   string
+		reason string
+	}{
+		{"plain message", &Inbound{Action: CHAT, Message: " hello "}, "hello", ""},
+		{"empty message", &Inbound{Action: CHAT, Message: "   "}, "", "empty message"},
+		{"too long", &Inbound{Action: CHAT, Message: strings.Repeat("a", maxChatLength+1)}, "", "message too long"},
+		{"max length", &Inbound{Action: CHAT, Message: strings.Repeat("a", maxChatLength)}, strings.Repeat("a", maxChatLength), ""},
+		{"quick message", &Inbound{Action: CHAT_QUICK, Message: "gg"}, "Good game", ""},
+		{"unknown quick message", &Inbound{Action: CHAT_QUICK, Message: "hello"}, "", "unknown quick message"},
+	}
+
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			text, reason := chatText(tt.in)
+			assert.Equal(t, tt.text, text)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestChatLimiter(t *testing.T) {
+	limiter := chatLimiter{}
+	now := time.Now()
+	for i := 0; i < chatBurst; i++ {
+		assert.True(t, limiter.allow(now), "message %d", i)
+	}
+	assert.False(t, limiter.allow(now))
+	assert.False(t, limiter.allow(now.Add(chatWindow/2)))
+	assert.True(t, limiter.allow(now.Add(chatWindow+time.Millisecond)))
+}
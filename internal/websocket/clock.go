@@ -0,0 +1,191 @@
+package websocket
+
+import (
+	"time"
+)
+
+// Clock is a two player chess clock. Elapsed time is measured from
+// time.Time values taken with time.Now, which carry a monotonic reading,
+// so wall clock changes do not affect the players' time.
+// A Clock is owned by the game loop and is not safe for concurrent use.
+type Clock struct {
+	tc        TimeControl
+	remaining [2]time.Duration // time left at the start of the current turn
+	moves     [2]int           // moves made by each player
+	berserk   [2]bool          // players who gave up half their time and their increment
+	active    int              // index of the running side, -1 if stopped
+	turnStart time.Time        // when the running side's turn started
+	flag      *time.Timer
+}
+
+func NewClock(tc TimeControl) *Clock {
+	base := seconds(tc.Stages[0].Time)
+	return &Clock{
+		tc:        tc,
+		remaining: [2]time.Duration{base, base},
+		active:    -1,
+	}
+}
+
+func seconds(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// increment returns the increment or delay of the player at index
+func (c *Clock) increment(index int) time.Duration {
+	if c.berserk[index] {
+		return 0
+	}
+	return seconds(c.tc.Stages[c.tc.stage(c.moves[index])].Increment)
+}
+
+// charged returns how much of elapsed comes off the running side's
+// clock. With a simple delay the clock only runs after the delay.
+func (c *Clock) charged(elapsed time.Duration) time.Duration {
+	if c.tc.Mode == DELAY {
+		return max(elapsed-c.increment(c.active), 0)
+	}
+	return elapsed
+}
+
+// Start runs the clock of the player at index from now
+func (c *Clock) Start(index int, now time.Time) {
+	c.active = index
+	c.turnStart = now
+	c.Rearm(now)
+}
+
+// Stop charges the running side for its turn so far and stops the clock
+func (c *Clock) Stop(now time.Time) {
+	if c.active == -1 {
+		return
+	}
+	c.stopFlag()
+	elapsed := now.Sub(c.turnStart)
+	c.remaining[c.active] -= c.charged(elapsed)
+	if c.tc.Mode == HOURGLASS {
+		c.remaining[(c.active+1)%2] += elapsed
+	}
+	c.active = -1
+}
+
+// Press ends the turn of the running side at now, applies the
+// increment, Bronstein delay or next stage of the time control and
+// starts the opponent's clock. Returns the time the turn took.
+func (c *Clock) Press(now time.Time) time.Duration {
+	if c.active == -1 {
+		return 0
+	}
+	index := c.active
+	elapsed := now.Sub(c.turnStart)
+	c.Stop(now)
+
+	switch c.tc.Mode {
+	case FISCHER:
+		c.remaining[index] += c.increment(index)
+	case BRONSTEIN:
+		c.remaining[index] += min(elapsed, c.increment(index))
+	}
+
+	stage := c.tc.stage(c.moves[index])
+	c.moves[index]++
+	if next := c.tc.stage(c.moves[index]); next != stage {
+		c.remaining[index] += seconds(c.tc.Stages[next].Time)
+	}
+
+	c.Start((index+1)%2, now)
+	return elapsed
+}
+
+// Restore sets the time left and moves made by each player of a
+// stopped clock, as they were before a restart
+func (c *Clock) Restore(remaining [2]time.Duration, moves [2]int) {
+	c.remaining = remaining
+	c.moves = moves
+}
+
+// Berserk halves the time left of the player at index and takes away
+// their increment for the rest of the game
+func (c *Clock) Berserk(index int, now time.Time) {
+	c.berserk[index] = true
+	c.remaining[index] -= c.remaining[index] / 2
+	if index == c.active {
+		c.Rearm(now)
+	}
+}
+
+// Moves returns the number of moves the player at index made
+func (c *Clock) Moves(index int) int {
+	return c.moves[index]
+}
+
+// Credit gives the player at index d more time at now
+func (c *Clock) Credit(index int, d time.Duration, now time.Time) {
+	c.remaining[index] += d
+	if index == c.active {
+		c.Rearm(now)
+	}
+}
+
+// TurnStart returns when the running side's turn started
+func (c *Clock) TurnStart() time.Time {
+	return c.turnStart
+}
+
+// Remaining returns the time left for the player at index at now
+func (c *Clock) Remaining(index int, now time.Time) time.Duration {
+	if c.active == -1 {
+		return c.remaining[index]
+	}
+	elapsed := now.Sub(c.turnStart)
+	if index == c.active {
+		return c.remaining[index] - c.charged(elapsed)
+	} else if c.tc.Mode == HOURGLASS {
+		return c.remaining[index] + elapsed
+	}
+	return c.remaining[index]
+}
+
+// Millis returns the time left for the player at index in milliseconds,
+// never less than zero
+func (c *Clock) Millis(index int, now time.Time) int {
+	return int(max(c.Remaining(index, now), 0).Milliseconds())
+}
+
+// Flag returns a channel that receives when the running side should run
+// out of time, or nil if the clock is stopped. Use Flagged to confirm.
+func (c *Clock) Flag() <-chan time.Time {
+	if c.flag == nil {
+		return nil
+	}
+	return c.flag.C
+}
+
+// Flagged returns the index of the running side if it is out of time
+func (c *Clock) Flagged(now time.Time) (int, bool) {
+	if c.active == -1 || c.Remaining(c.active, now) > 0 {
+		return -1, false
+	}
+	return c.active, true
+}
+
+// Rearm restarts the flag timer for when the running side runs out of
+// time, including what is left of a simple delay
+func (c *Clock) Rearm(now time.Time) {
+	if c.active == -1 {
+		return
+	}
+	c.stopFlag()
+	left := c.Remaining(c.active, now)
+	if c.tc.Mode == DELAY {
+		left += max(c.increment(c.active)-now.Sub(c.turnStart), 0)
+	}
+	c.flag = time.NewTimer(left)
+}
+
+func (c *Clock) stopFlag() {
+	if c.flag != nil {
+		c.flag.Stop()
+		c.flag = nil
+	}
+}
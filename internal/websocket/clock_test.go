@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Now()
+	clock := NewClock(FischerTimeControl(60, 2))
+	assert.Equal(t, time.Minute, clock.Remaining(whiteIndex, start))
+	assert.Nil(t, clock.Flag())
+
+	clock.Start(whiteIndex, start)
+	assert.NotNil(t, clock.Flag())
+	assert.Equal(t, 59900*time.Millisecond, clock.Remaining(whiteIndex, start.Add(100*time.Millisecond)))
+	assert.Equal(t, time.Minute, clock.Remaining(blackIndex, start.Add(100*time.Millisecond)))
+
+	// moves shorter than a second are charged
+	charged := clock.Press(start.Add(900 * time.Millisecond))
+	assert.Equal(t, 900*time.Millisecond, charged)
+	assert.Equal(t, 61100*time.Millisecond, clock.Remaining(whiteIndex, start.Add(5*time.Second)))
+	assert.Equal(t, 55900*time.Millisecond, clock.Remaining(blackIndex, start.Add(5*time.Second)))
+	assert.Equal(t, 55900, clock.Millis(blackIndex, start.Add(5*time.Second)))
+
+	// pressing at the start of the turn charges nothing
+	turnStart := clock.TurnStart()
+	assert.Equal(t, time.Duration(0), clock.Press(turnStart))
+	assert.Equal(t, 62*time.Second, clock.Remaining(blackIndex, turnStart))
+
+	_, flagged := clock.Flagged(turnStart.Add(time.Minute))
+	assert.False(t, flagged)
+	index, flagged := clock.Flagged(turnStart.Add(61100 * time.Millisecond))
+	assert.True(t, flagged)
+	assert.Equal(t, whiteIndex, index)
+	assert.Equal(t, 0, clock.Millis(whiteIndex, turnStart.Add(2*time.Minute)))
+
+	clock.Stop(turnStart.Add(time.Second))
+	assert.Nil(t, clock.Flag())
+	assert.Equal(t, 60100*time.Millisecond, clock.Remaining(whiteIndex, turnStart.Add(time.Hour)))
+	_, flagged = clock.Flagged(turnStart.Add(time.Hour))
+	assert.False(t, flagged)
+}
+
+func TestClockFlag(t *testing.T) {
+	clock := NewClock(FischerTimeControl(60, 0))
+	clock.remaining = [2]time.Duration{50 * time.Millisecond, 50 * time.Millisecond}
+	clock.Start(blackIndex, time.Now())
+
+	select {
+	case <-clock.Flag():
+		index, flagged := clock.Flagged(time.Now())
+		assert.True(t, flagged)
+		assert.Equal(t, blackIndex, index)
+	case <-time.After(time.Second):
+		t.Fatal("flag timer did not fire")
+	}
+}
+
+func TestClockModes(t *testing.T) {
+	inputs := []struct {
+		name  string
+		tc    TimeControl
+		turns []time.Duration // time taken by each move, starting with white
+		white time.Duration   // remaining time after all moves
+		black time.Duration
+	}{
+		{
+			name:  "fischer",
+			tc:    TimeControl{Mode: FISCHER, Stages: []Stage{{Time: 60, Increment: 5}}},
+			turns: []time.Duration{2 * time.Second, 10 * time.Second, 7 * time.Second},
+			white: 61 * time.Second,
+			black: 55 * time.Second,
+		},
+		{
+			name:  "simple delay",
+			tc:    TimeControl{Mode: DELAY, Stages: []Stage{{Time: 60, Increment: 5}}},
+			turns: []time.Duration{2 * time.Second, 10 * time.Second, 7 * time.Second},
+			white: 58 * time.Second,
+			black: 55 * time.Second,
+		},
+		{
+			name:  "bronstein",
+			tc:    TimeControl{Mode: BRONSTEIN, Stages: []Stage{{Time: 60, Increment: 5}}},
+			turns: []time.Duration{2 * time.Second, 10 * time.Second, 7 * time.Second},
+			white: 58 * time.Second,
+			black: 55 * time.Second,
+		},
+		{
+			name:  "hourglass",
+			tc:    TimeControl{Mode: HOURGLASS, Stages: []Stage{{Time: 60}}},
+			turns: []time.Duration{2 * time.Second, 10 * time.Second, 7 * time.Second},
+			white: 61 * time.Second,
+			black: 59 * time.Second,
+		},
+		{
+			name: "multi stage",
+			tc: TimeControl{Mode: FISCHER, Stages: []Stage{
+				{Moves: 2, Time: 60},
+				{Time: 30, Increment: 10},
+			}},
+			turns: []time.Duration{time.Second, time.Second, time.Second, time.Second, time.Second},
+			white: 97 * time.Second, // 60 - 3 + 30 for reaching the second stage + 10 increment
+			black: 88 * time.Second,
+		},
+	}
+
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			clock := NewClock(tt.tc)
+			clock.Start(whiteIndex, now)
+			for _, turn := range tt.turns {
+				now = now.Add(turn)
+				clock.Press(now)
+			}
+			clock.Stop(now)
+			assert.Equal(t, tt.white, clock.Remaining(whiteIndex, now))
+			assert.Equal(t, tt.black, clock.Remaining(blackIndex, now))
+		})
+	}
+}
+
+func TestLagCredit(t *testing.T) {
+	g := &Game{lagQuota: [2]time.Duration{lagQuotaInitial, lagQuotaInitial}}
+	assert.Equal(t, time.Duration(0), g.lagCredit(whiteIndex, time.Second), "disconnected players get no credit")
+
+	player := &Player{}
+	g.players[whiteIndex] = player
+	player.rtt.Store(int64(400 * time.Millisecond))
+	assert.Equal(t, 200*time.Millisecond, g.lagCredit(whiteIndex, time.Second))
+	assert.Equal(t, 50*time.Millisecond, g.lagCredit(whiteIndex, 50*time.Millisecond), "credit is at most the time spent")
+	assert.Equal(t, time.Duration(0), g.lagCredit(whiteIndex, 0), "premoves get no credit")
+
+	// huge lag is bounded per move and by the quota
+	player.rtt.Store(int64(10 * time.Second))
+	quota, total := g.lagQuota[whiteIndex], time.Duration(0)
+	for range 20 {
+		credit := g.lagCredit(whiteIndex, time.Minute)
+		assert.LessOrEqual(t, credit, maxLagCredit)
+		total += credit
+	}
+	assert.LessOrEqual(t, total, quota+20*lagQuotaGain)
+	assert.Equal(t, lagQuotaInitial, g.lagQuota[blackIndex])
+}
+
+func TestClockBerserk(t *testing.T) {
+	start := time.Now()
+	clock := NewClock(FischerTimeControl(60, 2))
+	clock.Start(whiteIndex, start)
+	clock.Berserk(whiteIndex, start.Add(time.Second))
+	assert.Equal(t, 29*time.Second, clock.Remaining(whiteIndex, start.Add(time.Second)))
+
+	// berserk players get no increment
+	clock.Press(start.Add(2 * time.Second))
+	assert.Equal(t, 28*time.Second, clock.Remaining(whiteIndex, start.Add(2*time.Second)))
+	assert.Equal(t, 1, clock.Moves(whiteIndex))
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	colorHistoryLength = 10             // games remembered for color balancing
+	colorHistoryExpiry = 24 * time.Hour // players without a game for this long are forgotten
+)
+
+// compatible returns true iff players with the color preferences a and b
+// can play each other
+func compatible(a, b string) bool {
+	return !(a == WHITE && b == WHITE) && !(a == BLACK && b == BLACK)
+}
+
+// colorHistory remembers the colors each player had in their recent
+// rated games. It is safe for concurrent use.
+type colorHistory struct {
+	mu     sync.Mutex
+	colors map[string][]int     // seats by handle, oldest first
+	played map[string]time.Time // last game by handle
+	pruned time.Time            // when expired players were last forgotten
+}
+
+func newColorHistory() *colorHistory {
+	return &colorHistory{
+		colors: make(map[string][]int),
+		played: make(map[string]time.Time),
+	}
+}
+
+// record remembers that handle played a game in the seat index at now,
+// and forgets the players who have not played for colorHistoryExpiry
+func (h *colorHistory) record(handle string, index int, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.pruned) >= colorHistoryExpiry {
+		for other, played := range h.played {
+			if now.Sub(played) >= colorHistoryExpiry {
+				delete(h.colors, other)
+				delete(h.played, other)
+			}
+		}
+		h.pruned = now
+	}
+
+	colors := append(h.colors[handle], index)
+	if len(colors) > colorHistoryLength {
+		colors = colors[len(colors)-colorHistoryLength:]
+	}
+	h.colors[handle] = colors
+	h.played[handle] = now
+}
+
+// balance returns how many more recent games handle played as white
+// than as black, and the seat of their last game or -1
+func (h *colorHistory) balance(handle string) (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	balance, last := 0, -1
+	for _, index := range h.colors[handle] {
+		if index == whiteIndex {
+			balance++
+		} else {
+			balance--
+		}
+		last = index
+	}
+	return balance, last
+}
+
+// fairer returns the seat of a in a game against b that evens out their
+// colors: the player who had white more often gets black, then the
+// player who had white last. Colors are random if neither decides.
+func (h *colorHistory) fairer(a, b string) int {
+	balanceA, lastA := h.balance(a)
+	balanceB, lastB := h.balance(b)
+	if balanceA != balanceB {
+		if balanceA > balanceB {
+			return blackIndex
+		}
+		return whiteIndex
+	} else if lastA != lastB {
+		if lastA == whiteIndex || lastB == blackIndex {
+			return blackIndex
+		}
+		return whiteIndex
+	}
+	return rand.IntN(2)
+}
+
+// takerColor returns the seat of the player of taker joining the seek s.
+// A color chosen by either player is kept, rated games balance the
+// colors of both players and casual games pick at random.
+func (l *Lobby) takerColor(s *seek, taker *seek) int {
+	switch {
+	case s.color == WHITE:
+		return blackIndex
+	case s.color == BLACK:
+		return whiteIndex
+	case taker.color == WHITE:
+		return whiteIndex
+	case taker.color == BLACK:
+		return blackIndex
+	case s.game.options.Rated:
+		return l.colors.fairer(taker.handle, s.handle)
+	}
+	return rand.IntN(2)
+}
@@ -1,18 +1,17 @@
 package websocket
 
 import (
+	"fmt"
 	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/JDRadatti/reptile/internal/store"
 	"github.com/google/uuid"
 	"log"
-	"slices"
+	"math"
+	"math/rand/v2"
 	"time"
 )
 
-var (
-	validTimes      = []int{60, 180, 300, 600}
-	validIncrements = []int{0, 1, 2, 10}
-)
-
 const (
 	defaultTime      = 300
 	maxWaitTime      = 300 // kill game if waiting for opponenet longer than maxWaitTime
@@ -32,52 +31,98 @@ const (
 type GameID string
 
 type Game struct {
-	id            GameID
-	players       [2]*Player
-	playerIDs     [2]PlayerID
-	timeRemaining [2]int
-	increment     int // number of seconds to add when player moves
-	join          chan *Player
-	leave         chan *Player
-	move          chan *Inbound // Moves requests sent from both white and black
-	resign        chan *Inbound
-	abort         chan *Inbound
-	draw          chan *Inbound
-	pendingDraw   int
-	board         *chess.Board
-	lobby         *Lobby
-	state         GameState
+	id              GameID
+	players         [2]*Player
+	playerIDs       [2]PlayerID
+	colorPrefs      [2]string // color preference of each seated player, see seatPlayerID
+	clock           *Clock
+	lagQuota        [2]time.Duration // lag compensation each player has left
+	options         GameOptions
+	started         time.Time // when both players first connected
+	join            chan *Player
+	seat            chan seatRequest
+	leave           chan *Player
+	move            chan *Inbound // Moves requests sent from both white and black
+	resign          chan *Inbound
+	abort           chan *Inbound
+	draw            chan *Inbound
+	chat            chan *Inbound
+	rematch         chan *Inbound
+	takeback        chan *Inbound
+	berserk         chan *Inbound
+	handoff         chan handoff  // moves the waiting player to another game, see pairWaiting
+	done            chan struct{} // closed once the game and rematch window are over
+	pendingDraw     int
+	pendingRematch  int
+	pendingTakeback int
+	premoves        [2][]string // moves queued by each player while it is not their turn
+	result          string      // chess.WHITEWIN, chess.BLACKWIN, chess.DRAW or "" if not finished
+	termination     string      // action of the end message
+	ratingDelta     []int
+	times           [][2]int // milliseconds left of white and black after each ply, the first are the starting times
+	board           *chess.Board
+	lobby           *Lobby
+	state           GameState
+	spectators      map[PlayerID]*spectator
+	playerChat      []ChatMessage
+	spectatorChat   []ChatMessage
+	chatLimits      [2]chatLimiter
+	chatMuted       [2]bool // chatMuted[i] is true if player i muted the opponent
+	journaled       bool    // the game has started in the lobby's journal
+	recovered       bool    // the game was rebuilt from the journal after a restart
+	suspended       bool    // the game was stopped by a shutdown and is left unfinished
+
+	wait           time.Duration    // how long players have to connect
+	joined         [2]bool          // whether each player connected, see GameResult
+	berserkAllowed bool             // see Pairing
+	berserked      [2]bool          // players who went berserk
+	onEnd          func(GameResult) // nil unless the game was started with StartGame
+	tournament     string           // see Pairing
 }
 
-func NewGame(l *Lobby, time int, increment int) *Game {
+func NewGame(l *Lobby, options GameOptions) *Game {
+	newGame := newGame(l, options, generateGameID())
+	l.run(newGame)
+	return newGame
+}
 
-	if !slices.Contains(validTimes, time) {
-		time = defaultTime
-	}
+// newGame returns a game that is not running yet
+func newGame(l *Lobby, options GameOptions, id GameID) *Game {
 
-	if !slices.Contains(validIncrements, increment) {
-		increment = defaultIncrement
+	if options.Validate() != nil {
+		options = defaultGameOptions
 	}
 
 	board := chess.NewBoardClassic()
 	newGame := &Game{
-		id:            generateGameID(),
-		move:          make(chan *Inbound),
-		resign:        make(chan *Inbound),
-		draw:          make(chan *Inbound),
-		abort:         make(chan *Inbound),
-		join:          make(chan *Player),
-		leave:         make(chan *Player),
-		board:         &board,
-		timeRemaining: [2]int{time, time},
-		players:       [2]*Player{},
-		playerIDs:     [2]PlayerID{},
-		pendingDraw:   -1,
-		increment:     increment,
-		lobby:         l,
-		state:         waiting,
-	}
-	go newGame.play()
+		id:              id,
+		move:            make(chan *Inbound),
+		resign:          make(chan *Inbound),
+		draw:            make(chan *Inbound),
+		abort:           make(chan *Inbound),
+		chat:            make(chan *Inbound),
+		rematch:         make(chan *Inbound),
+		takeback:        make(chan *Inbound),
+		berserk:         make(chan *Inbound),
+		handoff:         make(chan handoff),
+		done:            make(chan struct{}),
+		join:            make(chan *Player),
+		seat:            make(chan seatRequest),
+		leave:           make(chan *Player),
+		board:           &board,
+		clock:           NewClock(options.TimeControl),
+		lagQuota:        [2]time.Duration{lagQuotaInitial, lagQuotaInitial},
+		players:         [2]*Player{},
+		playerIDs:       [2]PlayerID{},
+		spectators:      make(map[PlayerID]*spectator),
+		pendingDraw:     -1,
+		pendingRematch:  -1,
+		pendingTakeback: -1,
+		options:         options,
+		lobby:           l,
+		state:           waiting,
+		wait:            time.Second * time.Duration(maxWaitTime),
+	}
 	return newGame
 }
 
@@ -89,9 +134,22 @@ func generateGameID() GameID {
 	return GameID(uuid.String()[:8])
 }
 
+// ID returns the id of the game, used in its link
+func (g *Game) ID() GameID {
+	return g.id
+}
+
 func (g *Game) clean() {
 	g.state = over
+	g.lobby.removeFromPool(g)
+	g.archive()
+	if !g.suspended {
+		g.journal(store.Entry{Kind: store.END})
+	}
 	g.lobby.Clean(g.id, g.playerIDs[whiteIndex], g.playerIDs[blackIndex])
+	if g.onEnd != nil && !g.suspended {
+		g.onEnd(g.gameResult())
+	}
 }
 
 func (g *Game) playerFromID(playerID PlayerID) (*Player, int, bool) {
@@ -119,6 +177,66 @@ func (g *Game) playerIndex(playerID PlayerID) (int, bool) {
 	}
 }
 
+// seatRequest asks the game loop for the seat of pid
+type seatRequest struct {
+	pid   PlayerID
+	color int      // seat to take, -1 to leave it to the game
+	pref  string   // color preference of the player, "" if unknown
+	index chan int // receives the seat, -1 if there is none
+}
+
+// takeSeat seats pid in the waiting game, see seatPlayerID, or returns
+// the seat pid already has. Unlike addPlayerID it is safe to call from
+// any goroutine.
+func (g *Game) takeSeat(pid PlayerID, color int, pref string) (int, bool) {
+	request := seatRequest{pid: pid, color: color, pref: pref, index: make(chan int, 1)}
+	select {
+	case g.seat <- request:
+		index := <-request.index
+		return index, index != -1
+	case <-g.done:
+		return -1, false
+	}
+}
+
+// seatPlayerID seats pid in the seat color. A player already seated
+// there without a color preference is moved to the other seat, one who
+// chose the color keeps it. With color -1 pid takes the free seat, or a
+// random seat if the seated player asked for a random color.
+// Returns the seat, -1 if the game is full.
+func (g *Game) seatPlayerID(pid PlayerID, color int, pref string) int {
+	seated := -1
+	if g.playerIDs[whiteIndex] != "" && g.playerIDs[blackIndex] != "" {
+		return -1
+	} else if g.playerIDs[whiteIndex] != "" {
+		seated = whiteIndex
+	} else if g.playerIDs[blackIndex] != "" {
+		seated = blackIndex
+	}
+
+	if color == -1 && seated != -1 && g.colorPrefs[seated] == RANDOM {
+		color = rand.IntN(2)
+	} else if color == -1 && seated == whiteIndex {
+		color = blackIndex
+	} else if color == -1 {
+		color = whiteIndex
+	}
+	if color == seated {
+		other := (seated + 1) % 2
+		if pref := g.colorPrefs[seated]; pref == WHITE || pref == BLACK {
+			color = other
+		} else {
+			g.playerIDs[other], g.players[other], g.colorPrefs[other] = g.playerIDs[seated], g.players[seated], g.colorPrefs[seated]
+			g.playerIDs[seated], g.players[seated], g.colorPrefs[seated] = "", nil, ""
+		}
+	}
+	g.playerIDs[color] = pid
+	g.colorPrefs[color] = pref
+	return color
+}
+
+// addPlayerID seats playerID in the first free seat. Only the game loop,
+// or whoever creates the game before it runs, may call it.
 func (g *Game) addPlayerID(playerID PlayerID) (int, bool) {
 	if g.playerIDs[whiteIndex] == "" {
 		g.playerIDs[whiteIndex] = playerID
@@ -131,10 +249,112 @@ func (g *Game) addPlayerID(playerID PlayerID) (int, bool) {
 	}
 }
 
+// takeBack undoes plies half moves at now. Both players get back the
+// time they had when the last move left on the board was played.
+func (g *Game) takeBack(plies int, now time.Time) {
+	for range plies {
+		g.board.Undo()
+	}
+	played := g.board.Plies()
+	g.times = g.times[:played+1]
+
+	times := g.times[played]
+	g.clock.Stop(now)
+	g.clock.Restore(
+		[2]time.Duration{time.Duration(times[whiteIndex]) * time.Millisecond, time.Duration(times[blackIndex]) * time.Millisecond},
+		[2]int{(played + 1) / 2, played / 2},
+	)
+	g.clock.Start(g.currentPlayerIndex(), now)
+}
+
+// startClock starts the clock of the player to move at now. The times
+// of a new game are recorded as its starting times.
+func (g *Game) startClock(now time.Time) {
+	if len(g.times) == 0 {
+		g.times = append(g.times, g.clockTimes(now))
+	}
+	g.clock.Start(g.currentPlayerIndex(), now)
+}
+
+// clockTimes returns the milliseconds left of white and black at now
+func (g *Game) clockTimes(now time.Time) [2]int {
+	return [2]int{g.clock.Millis(whiteIndex, now), g.clock.Millis(blackIndex, now)}
+}
+
 func (g *Game) currentPlayerIndex() int {
 	return int(g.board.Turn())
 }
 
+// handleMove plays the move of request, queues it as a premove or
+// cancels the premoves of its player. Requests of a connection that
+// was dropped are skipped, see sender.
+// Returns whether the game is over.
+func (g *Game) handleMove(request *Inbound) bool {
+	if g.state != playing {
+		return false
+	}
+
+	player, index, ok := g.sender(request)
+	if !ok {
+		return false
+	} else if request.Action == PREMOVE_CANCEL {
+		g.premoves[index] = nil
+		g.deliver(player, g.premoveOut(PREMOVE, index))
+		return false
+	} else if index != g.currentPlayerIndex() {
+		g.queuePremove(player, index, request.Move)
+		return false
+	}
+
+	if valid, over := g.playMove(index, request.Move, time.Now()); over {
+		return true
+	} else if valid && g.playPremoves() {
+		return true
+	}
+	return false
+}
+
+// playMove plays move for the player at index, which must be the
+// player to move, and presses their clock at now, crediting back an
+// estimate of their network lag.
+// Returns whether the move was valid and whether it ended the game.
+func (g *Game) playMove(index int, m string, now time.Time) (bool, bool) {
+	move, valid := g.board.Move(m)
+	if valid {
+		elapsed := g.clock.Press(now)
+		g.clock.Credit(index, g.lagCredit(index, elapsed), now)
+		g.times = append(g.times, g.clockTimes(now))
+		coordinates := g.board.Coordinates()
+		g.journal(store.Entry{Kind: store.MOVE, Move: coordinates[len(coordinates)-1], Clocks: g.journalClocks(now)})
+		out := g.out(MOVE_SUCCESS, g.playerIDs[index])
+		out.Move = move
+		g.sendAll(out)
+		g.pendingDraw = -1
+		g.pendingTakeback = -1
+	}
+
+	if status, over := g.board.GameOver(); over {
+		out := g.out(GAME_END, g.playerIDs[index])
+		out.Move = status
+		g.end(out, status)
+		return valid, true
+	}
+	return valid, false
+}
+
+// takebackPlies returns the number of half moves to take back so it is
+// the turn of the player at index again: their last move and, if the
+// opponent already replied, the opponent's move too.
+func (g *Game) takebackPlies(index int) int {
+	plies := g.board.Plies()
+	if g.currentPlayerIndex() != index && plies >= 1 {
+		return 1
+	} else if g.currentPlayerIndex() == index && plies >= 2 {
+		return 2
+	}
+	return 0
+}
+
 func (g *Game) bothPlayersConnected() bool {
 	return g.players[whiteIndex] != nil && g.players[blackIndex] != nil
 }
@@ -143,133 +363,303 @@ func (g *Game) out(action string, pid PlayerID) *Outbound {
 	return &Outbound{
 		Action:    action,
 		Move:      g.board.LastMove(),
-		PlayerID:  pid, // Player who made the move
+		Handle:    g.handle(pid), // Player who made the move
 		GameID:    g.id,
 		FEN:       string(g.board.FEN()),
 		Turn:      g.board.Turn(),
-		WhiteTime: g.timeRemaining[whiteIndex],
-		BlackTime: g.timeRemaining[blackIndex],
+		WhiteTime: g.clock.Millis(whiteIndex, time.Now()),
+		BlackTime: g.clock.Millis(blackIndex, time.Now()),
+		WhiteLag:  g.lagMillis(whiteIndex),
+		BlackLag:  g.lagMillis(blackIndex),
+	}
+}
+
+// handle returns the public name of pid, empty if pid is empty
+func (g *Game) handle(pid PlayerID) string {
+	if pid == "" {
+		return ""
 	}
+	return g.lobby.Handle(pid)
 }
 
 func (g *Game) sendBoth(out *Outbound) {
 	if g.players[whiteIndex] != nil {
-		g.players[whiteIndex].send <- out
+		g.deliver(g.players[whiteIndex], out)
 	}
 	if g.players[blackIndex] != nil {
-		g.players[blackIndex].send <- out
+		g.deliver(g.players[blackIndex], out)
 	}
 }
 
+// sendStart sends GAME_START to everyone, with the color of each player
+// since seats can change until the game starts
+func (g *Game) sendStart() {
+	for index, player := range g.players {
+		if player != nil {
+			out := g.out(GAME_START, "")
+			out.Player = chess.Player(index)
+			g.deliver(player, out)
+		}
+	}
+	out := g.out(GAME_START, "")
+	out.Player = chess.INVALID_PLAYER
+	for _, s := range g.spectators {
+		g.deliver(s.player, out)
+	}
+}
+
+// sendAll sends out to both players and every spectator
+func (g *Game) sendAll(out *Outbound) {
+	g.sendBoth(out)
+	for _, s := range g.spectators {
+		g.deliver(s.player, out)
+	}
+}
+
+// end stops the clock, records the result of the game and sends out
+// to everyone
+func (g *Game) end(out *Outbound, result string) {
+	g.clock.Stop(time.Now())
+	g.result = result
+	g.termination = out.Action
+	out.PGN = g.pgn()
+	if g.options.Rated {
+		g.ratingDelta = g.rate()
+		out.RatingDelta = g.ratingDelta
+	}
+	g.sendAll(out)
+}
+
+// rate updates the ratings of both players with the result of the game
+// and returns the change in their ratings
+func (g *Game) rate() []int {
+	score := rating.DRAW
+	if g.result == chess.WHITEWIN {
+		score = rating.WIN
+	} else if g.result == chess.BLACKWIN {
+		score = rating.LOSS
+	}
+	white, black := g.lobby.Ratings.Record(g.options.category(),
+		g.handle(g.playerIDs[whiteIndex]), g.handle(g.playerIDs[blackIndex]), score)
+	return []int{int(math.Round(white)), int(math.Round(black))}
+}
+
+// pgn returns the game in Portable Game Notation
+func (g *Game) pgn() string {
+	return g.record().PGN()
+}
+
+// winner returns the result of a game won by the player at index
+func winner(index int) string {
+	if index == whiteIndex {
+		return chess.WHITEWIN
+	}
+	return chess.BLACKWIN
+}
+
 func (g *Game) sendToOpponent(out *Outbound, index int) {
 	if g.players[(index+1)%2] != nil {
-		g.players[(index+1)%2].send <- out // send to other index
+		g.deliver(g.players[(index+1)%2], out) // send to other index
 	}
 }
 
 func (g *Game) play() {
 	ticker := time.NewTicker(time.Second)
-	timer := time.NewTimer(time.Second * time.Duration(maxWaitTime))
+	timer := time.NewTimer(g.wait)
+	ticks := 0
 	defer func() {
 		ticker.Stop()
 		timer.Stop()
 		g.clean()
+		g.postGame()
+		close(g.done)
+		g.lobby.running.Done()
 	}()
+	draining := g.lobby.draining
 
 	for {
 		select {
+		case request := <-g.seat:
+			index, ok := g.playerIndex(request.pid)
+			if !ok && g.state == waiting {
+				index = g.seatPlayerID(request.pid, request.color, request.pref)
+			}
+			request.index <- index
 		case player := <-g.join:
+			out := handshakeSuccess(g.lobby, player.id, g)
+			out.Token = player.token
+			g.deliver(player, out)
+			if player.spectator {
+				if len(g.spectators) >= spectatorLimit {
+					g.drop(player)
+					continue
+				}
+				g.spectators[player.id] = &spectator{player: player}
+				g.chatHistory(player)
+				if g.state == playing {
+					g.deliver(player, g.out(GAME_START, ""))
+				}
+				continue
+			}
 			if index, ok := g.playerIndex(player.id); ok {
+				if old := g.players[index]; old != nil && old != player {
+					g.disconnect(old) // reconnected from somewhere else
+				}
 				g.players[index] = player
+				g.joined[index] = true
+				g.chatHistory(player)
 			}
 			if g.bothPlayersConnected() {
-				startOut := g.out(GAME_START, "")
-				g.sendBoth(startOut)
+				if g.state == waiting {
+					now := time.Now()
+					if g.started.IsZero() {
+						g.started = now
+						if g.options.Rated {
+							g.lobby.colors.record(g.handle(g.playerIDs[whiteIndex]), whiteIndex, now)
+							g.lobby.colors.record(g.handle(g.playerIDs[blackIndex]), blackIndex, now)
+						}
+					}
+					if !g.journaled {
+						g.journalStart()
+					}
+					g.startClock(now)
+				}
+				g.sendStart()
 				g.state = playing
 			}
 		case player := <-g.leave:
-			if index, ok := g.playerIndex(player.id); ok {
-				g.players[index] = nil
-				close(player.send)
-			}
-		case <-ticker.C:
-			if g.state != playing {
-				continue
-			}
-			currentI := g.currentPlayerIndex()
-			if g.timeRemaining[currentI] < 0 {
-				out := g.out(GAME_END_TIME, g.playerIDs[currentI])
-				g.sendBoth(out)
+			g.drop(player)
+		case h := <-g.handoff:
+			moved := g.handOff(h)
+			h.moved <- moved
+			if moved {
 				return
 			}
-			out := g.out(TIME_UPDATE, "")
-			g.sendBoth(out)
-			g.timeRemaining[currentI]--
-		case <-timer.C:
-			if g.state == waiting {
-				killOut := g.out(GAME_KILL, "")
-				g.sendBoth(killOut)
+		case <-draining:
+			draining = nil
+			out := g.out(SHUTDOWN, "")
+			out.Message = g.lobby.shutdownMessage
+			g.sendAll(out)
+			if g.state == waiting { // no one is playing yet
+				g.suspended = g.journaled
 				return
 			}
-		case moveRequest := <-g.move:
+		case <-g.lobby.stopping:
+			if g.tournament != "" { // not recovered, the game ends unfinished
+				g.termination = SHUTDOWN
+			} else {
+				g.suspended = true
+			}
+			return
+		case <-ticker.C:
 			if g.state != playing {
 				continue
 			}
-
-			player, index, ok := g.playerFromID(moveRequest.PlayerID)
-			if !ok || index != g.currentPlayerIndex() {
+			out := g.out(TIME_UPDATE, "")
+			g.sendAll(out)
+			ticks++
+			if ticks%journalClockTicks == 0 {
+				g.journal(store.Entry{Kind: store.CLOCK, Clocks: g.journalClocks(time.Now())})
+			}
+		case <-g.clock.Flag():
+			now := time.Now()
+			index, flagged := g.clock.Flagged(now)
+			if !flagged {
+				g.clock.Rearm(now)
 				continue
 			}
-
-			move, valid := g.board.Move(moveRequest.Move)
-			if valid {
-				out := g.out(MOVE_SUCCESS, player.id)
-				out.Move = move
-				g.sendBoth(out)
-				g.pendingDraw = -1
+			g.clock.Stop(now)
+			out := g.out(GAME_END_TIME, g.playerIDs[index])
+			g.end(out, winner((index+1)%2))
+			return
+		case <-timer.C:
+			if g.state == waiting && g.recovered {
+				out := g.out(ABORT, "")
+				out.Message = fmt.Sprintf("players did not reconnect in %d seconds", int(g.wait.Seconds()))
+				g.sendAll(out)
+				return
+			} else if g.state == waiting {
+				out := g.out(QUEUE_TIMEOUT, "")
+				out.Message = fmt.Sprintf("no opponent found in %d seconds", int(g.wait.Seconds()))
+				g.sendAll(out)
+				return
 			}
-
-			if status, over := g.board.GameOver(); over {
-				out := g.out(GAME_END, player.id)
-				out.Move = status
-				g.sendBoth(out)
+		case moveRequest := <-g.move:
+			if g.handleMove(moveRequest) {
 				return
 			}
-
-			g.timeRemaining[index] += g.increment
 		case resignRequest := <-g.resign:
-			if index, ok := g.playerIndex(resignRequest.PlayerID); ok {
+			if g.state != playing {
+				continue
+			}
+			if _, index, ok := g.sender(resignRequest); ok {
 				out := g.out(RESIGN, g.playerIDs[index])
-				g.sendBoth(out)
+				g.end(out, winner((index+1)%2))
 				return
 			}
 		case abortRequest := <-g.abort:
-			if index, ok := g.playerIndex(abortRequest.PlayerID); ok {
-				if !g.board.CanAbort() {
+			if _, index, ok := g.sender(abortRequest); ok {
+				if !g.board.CanAbort() || g.onEnd != nil { // tournament games are resigned
 					continue
 				}
 				out := g.out(ABORT, g.playerIDs[index])
-				g.sendBoth(out)
+				g.sendAll(out)
 				return
 			}
 		case drawRequest := <-g.draw:
-			if index, ok := g.playerIndex(drawRequest.PlayerID); ok {
+			if g.state != playing {
+				continue
+			}
+			if _, index, ok := g.sender(drawRequest); ok {
 				if g.pendingDraw == -1 && drawRequest.Action == DRAW_REQUEST {
 					out := g.out(DRAW_REQUEST, g.playerIDs[index])
 					g.sendToOpponent(out, index)
 					g.pendingDraw = index
 				} else if g.pendingDraw == (index+1)%2 && drawRequest.Action == DRAW_ACCEPT {
 					out := g.out(DRAW, g.playerIDs[index])
-					g.sendBoth(out)
+					g.end(out, chess.DRAW)
 					return
 				} else if drawRequest.Action == DRAW_DENY {
 					out := g.out(DRAW_DENY, g.playerIDs[index])
-					out.Player = g.playerType(out.PlayerID)
+					out.Player = chess.Player(index)
 					g.sendBoth(out)
 					g.pendingDraw = -1
 				}
 			}
-
+		case takebackRequest := <-g.takeback:
+			_, index, ok := g.sender(takebackRequest)
+			if !ok || g.state != playing || g.options.Rated { // takebacks are only allowed in casual games
+				continue
+			}
+			if g.pendingTakeback == -1 && takebackRequest.Action == TAKEBACK_REQUEST {
+				if g.takebackPlies(index) == 0 {
+					continue
+				}
+				out := g.out(TAKEBACK_REQUEST, g.playerIDs[index])
+				g.sendToOpponent(out, index)
+				g.pendingTakeback = index
+			} else if g.pendingTakeback == (index+1)%2 && takebackRequest.Action == TAKEBACK_ACCEPT {
+				now := time.Now()
+				g.takeBack(g.takebackPlies(g.pendingTakeback), now)
+				g.journal(store.Entry{Kind: store.TAKEBACK, Plies: g.board.Plies(), Clocks: g.journalClocks(now)})
+				out := g.out(TAKEBACK, g.playerIDs[g.pendingTakeback])
+				out.Moves = g.board.Moves()
+				g.sendAll(out)
+				g.premoves = [2][]string{}
+				g.pendingTakeback = -1
+				g.pendingDraw = -1
+			} else if g.pendingTakeback != -1 && takebackRequest.Action == TAKEBACK_DENY {
+				out := g.out(TAKEBACK_DENY, g.playerIDs[index])
+				out.Player = chess.Player(index)
+				g.sendBoth(out)
+				g.pendingTakeback = -1
+			}
+		case chatRequest := <-g.chat:
+			g.handleChat(chatRequest)
+		case berserkRequest := <-g.berserk:
+			if _, index, ok := g.sender(berserkRequest); ok {
+				g.goBerserk(index)
+			}
 		}
 	}
 }
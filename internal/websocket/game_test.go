@@ -0,0 +1,523 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/JDRadatti/reptile/internal/store"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startGame matches two players and connects both to the game
+func startGame(t *testing.T, l *Lobby, request GameRequest) (*websocket.Conn, *websocket.Conn, PlayerID, PlayerID) {
+	t.Helper()
+
+	white, black := GeneratePlayerID(), GeneratePlayerID()
+	request.PlayerID = white
+	whiteRequest := request
+	response := l.Match(&whiteRequest)
+	request.PlayerID = black
+	if l.Match(&request).Player == chess.WHITE { // colors are random
+		white, black = black, white
+	}
+
+	whiteConn := connect(t, l, response.GameID, white)
+	blackConn := connect(t, l, response.GameID, black)
+	receiveAction(t, whiteConn, GAME_START)
+	receiveAction(t, blackConn, GAME_START)
+	return whiteConn, blackConn, white, black
+}
+
+// playMove sends a move from the player on conn and waits until both
+// players have received it
+func playMove(t *testing.T, conn *websocket.Conn, pid PlayerID, move string, conns ...*websocket.Conn) Outbound {
+	t.Helper()
+
+	sendMessage(t, conn, &Inbound{Action: MOVE, PlayerID: pid, Move: move})
+	var out Outbound
+	for _, c := range conns {
+		out = receiveAction(t, c, MOVE_SUCCESS)
+	}
+	return out
+}
+
+func TestTakeback(t *testing.T) {
+	l := NewLobby()
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60})
+	board := chess.NewBoardClassic()
+	startingFEN := string(board.FEN())
+
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+	playMove(t, blackConn, black, "e7e5", whiteConn, blackConn)
+
+	// white's turn, so white's last full move is taken back
+	sendMessage(t, whiteConn, &Inbound{Action: TAKEBACK_REQUEST, PlayerID: white})
+	receiveAction(t, blackConn, TAKEBACK_REQUEST)
+	sendMessage(t, blackConn, &Inbound{Action: TAKEBACK_ACCEPT, PlayerID: black})
+	out := receiveAction(t, whiteConn, TAKEBACK)
+	assert.Equal(t, startingFEN, out.FEN)
+	assert.Empty(t, out.Moves)
+	assert.Equal(t, chess.WHITE, out.Turn)
+	receiveAction(t, blackConn, TAKEBACK)
+
+	playMove(t, whiteConn, white, "d2d4", whiteConn, blackConn)
+
+	// black's turn, so only white's move is taken back
+	sendMessage(t, whiteConn, &Inbound{Action: TAKEBACK_REQUEST, PlayerID: white})
+	receiveAction(t, blackConn, TAKEBACK_REQUEST)
+	sendMessage(t, blackConn, &Inbound{Action: TAKEBACK_DENY, PlayerID: black})
+	receiveAction(t, whiteConn, TAKEBACK_DENY)
+	sendMessage(t, whiteConn, &Inbound{Action: TAKEBACK_REQUEST, PlayerID: white})
+	receiveAction(t, blackConn, TAKEBACK_REQUEST)
+	sendMessage(t, blackConn, &Inbound{Action: TAKEBACK_ACCEPT, PlayerID: black})
+	out = receiveAction(t, whiteConn, TAKEBACK)
+	assert.Equal(t, startingFEN, out.FEN)
+	assert.Equal(t, chess.WHITE, out.Turn)
+}
+
+func TestTakebackClock(t *testing.T) {
+	g := newGame(NewLobby(), GameOptions{TimeControl: FischerTimeControl(60, 2), Variant: STANDARD}, generateGameID())
+	now := time.Now()
+	g.startClock(now)
+	for _, move := range []string{"e2e4", "e7e5", "g1f3"} {
+		now = now.Add(10 * time.Second)
+		g.playMove(g.currentPlayerIndex(), move, now)
+	}
+
+	// white's knight move is taken back, white is back to the time after e4
+	now = now.Add(5 * time.Second)
+	g.takeBack(1, now)
+	assert.Equal(t, []int{52000, 52000}, g.moveClocks())
+	assert.Equal(t, 52000, g.clock.Millis(whiteIndex, now))
+	assert.Equal(t, 52000, g.clock.Millis(blackIndex, now))
+	assert.Equal(t, [2]int{1, 1}, [2]int{g.clock.Moves(whiteIndex), g.clock.Moves(blackIndex)})
+
+	// back to the start, both have their starting time
+	g.takeBack(2, now)
+	assert.Empty(t, g.moveClocks())
+	assert.Equal(t, 60000, g.clock.Millis(whiteIndex, now))
+	assert.Equal(t, 60000, g.clock.Millis(blackIndex, now))
+	assert.Equal(t, [2]int{0, 0}, [2]int{g.clock.Moves(whiteIndex), g.clock.Moves(blackIndex)})
+	assert.Equal(t, whiteIndex, g.currentPlayerIndex())
+}
+
+func TestTakebackHourglass(t *testing.T) {
+	g := newGame(NewLobby(), GameOptions{TimeControl: TimeControl{Mode: HOURGLASS, Stages: []Stage{{Time: 60}}}, Variant: STANDARD}, generateGameID())
+	now := time.Now()
+	g.startClock(now)
+	for _, move := range []string{"e2e4", "e7e5", "g1f3"} {
+		now = now.Add(10 * time.Second)
+		g.playMove(g.currentPlayerIndex(), move, now)
+	}
+
+	// the time white used for the knight move went to black, it is given back
+	now = now.Add(5 * time.Second)
+	g.takeBack(1, now)
+	assert.Equal(t, 60000, g.clock.Millis(whiteIndex, now))
+	assert.Equal(t, 60000, g.clock.Millis(blackIndex, now))
+	g.takeBack(2, now)
+	assert.Equal(t, 60000, g.clock.Millis(whiteIndex, now))
+	assert.Equal(t, 60000, g.clock.Millis(blackIndex, now))
+
+	g.playMove(whiteIndex, "e2e4", now.Add(20*time.Second))
+	g.takeBack(1, now.Add(20*time.Second))
+	assert.Equal(t, 60000, g.clock.Millis(whiteIndex, now.Add(20*time.Second)))
+	assert.Equal(t, 60000, g.clock.Millis(blackIndex, now.Add(20*time.Second)))
+}
+
+func TestTakebackArmageddon(t *testing.T) {
+	l := NewLobby()
+	white, black := GeneratePlayerID(), GeneratePlayerID()
+	gid, err := l.StartGame(Pairing{
+		White:   white,
+		Black:   black,
+		Options: GameOptions{TimeControl: FischerTimeControl(60, 0), Variant: STANDARD},
+		Time:    [2]time.Duration{time.Minute, 45 * time.Second},
+	})
+	assert.NoError(t, err)
+	whiteConn := connect(t, l, gid, white)
+	blackConn := connect(t, l, gid, black)
+	receiveAction(t, whiteConn, GAME_START)
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+
+	// black is back to the armageddon time, not the time control's
+	sendMessage(t, whiteConn, &Inbound{Action: TAKEBACK_REQUEST})
+	receiveAction(t, blackConn, TAKEBACK_REQUEST)
+	sendMessage(t, blackConn, &Inbound{Action: TAKEBACK_ACCEPT})
+	out := receiveAction(t, whiteConn, TAKEBACK)
+	assert.InDelta(t, 60000, out.WhiteTime, 1000)
+	assert.Equal(t, 45000, out.BlackTime)
+}
+
+func TestPremoveAfterDrop(t *testing.T) {
+	// a game that is not running, with black dropped as too slow
+	white, black := PlayerID("white"), PlayerID("black")
+	game := NewGame(NewLobby(), defaultGameOptions)
+	game.playerIDs = [2]PlayerID{white, black}
+	game.state = playing
+	game.board.Move("e2e4")
+	assert.False(t, game.handleMove(&Inbound{Action: MOVE, PlayerID: black, Move: "e7e5"}), "the move of a dropped player is skipped")
+	assert.Empty(t, game.premoves[blackIndex])
+	assert.False(t, game.handleMove(&Inbound{Action: PREMOVE_CANCEL, PlayerID: black}))
+	game.board.Move("e7e5")
+	assert.False(t, game.handleMove(&Inbound{Action: MOVE, PlayerID: black, Move: "g8f6"}), "so is a premove")
+	assert.Empty(t, game.premoves[blackIndex])
+}
+
+func TestSenderAfterDrop(t *testing.T) {
+	white, black := PlayerID("white"), PlayerID("black")
+	game := NewGame(NewLobby(), defaultGameOptions)
+	game.playerIDs = [2]PlayerID{white, black}
+	player := &Player{id: white, send: make(chan *Outbound, 1)}
+	game.players[whiteIndex] = player
+
+	resign := &Inbound{Action: RESIGN, PlayerID: white, from: player}
+	_, index, ok := game.sender(resign)
+	assert.True(t, ok)
+	assert.Equal(t, whiteIndex, index)
+	_, _, ok = game.sender(&Inbound{Action: RESIGN, PlayerID: white})
+	assert.False(t, ok, "not read from the seated connection")
+
+	// messages queued before the drop are rejected, also after a reconnect
+	game.drop(player)
+	_, _, ok = game.sender(resign)
+	assert.False(t, ok)
+	game.players[whiteIndex] = &Player{id: white, send: make(chan *Outbound, 1)}
+	_, _, ok = game.sender(resign)
+	assert.False(t, ok)
+}
+
+func TestPremove(t *testing.T) {
+	l := NewLobby()
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60})
+
+	sendMessage(t, blackConn, &Inbound{Action: MOVE, PlayerID: black, Move: "e7e5"})
+	out := receiveAction(t, blackConn, PREMOVE)
+	assert.Equal(t, []string{"e7e5"}, out.Moves)
+
+	// a second premove replaces the first
+	sendMessage(t, blackConn, &Inbound{Action: MOVE, PlayerID: black, Move: "d7d5"})
+	out = receiveAction(t, blackConn, PREMOVE)
+	assert.Equal(t, []string{"d7d5"}, out.Moves)
+
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+	out = receiveAction(t, whiteConn, MOVE_SUCCESS)
+	assert.Equal(t, "d5", out.Move)
+	assert.Equal(t, chess.WHITE, out.Turn)
+	receiveAction(t, blackConn, MOVE_SUCCESS)
+
+	// illegal premoves are discarded
+	sendMessage(t, blackConn, &Inbound{Action: MOVE, PlayerID: black, Move: "d5d3"})
+	receiveAction(t, blackConn, PREMOVE)
+	playMove(t, whiteConn, white, "a2a3", whiteConn, blackConn)
+	out = receiveAction(t, blackConn, PREMOVE_FAIL)
+	assert.Equal(t, "d5d3", out.Move)
+	assert.Empty(t, out.Moves)
+
+	// cancelled premoves are not played
+	playMove(t, blackConn, black, "a7a6", whiteConn, blackConn)
+	sendMessage(t, blackConn, &Inbound{Action: MOVE, PlayerID: black, Move: "b7b6"})
+	receiveAction(t, blackConn, PREMOVE)
+	sendMessage(t, blackConn, &Inbound{Action: PREMOVE_CANCEL, PlayerID: black})
+	out = receiveAction(t, blackConn, PREMOVE)
+	assert.Empty(t, out.Moves)
+	out = playMove(t, whiteConn, white, "h2h3", whiteConn, blackConn)
+	assert.Equal(t, chess.BLACK, out.Turn)
+}
+
+func TestRatedGame(t *testing.T) {
+	l := NewLobby()
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60, Rated: true})
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+
+	sendMessage(t, blackConn, &Inbound{Action: RESIGN, PlayerID: black})
+	out := receiveAction(t, whiteConn, RESIGN)
+	assert.Len(t, out.RatingDelta, 2)
+	assert.Greater(t, out.RatingDelta[0], 0)
+	assert.Less(t, out.RatingDelta[1], 0)
+	assert.Equal(t, 1, l.Ratings.Profile(l.Handle(white))[rating.BULLET].Games)
+	assert.Equal(t, 0, l.Ratings.Profile(l.Handle(white))[rating.BLITZ].Games)
+	assert.Equal(t, l.Handle(black), out.Handle)
+	assert.Empty(t, out.PlayerID)
+}
+
+func TestArchive(t *testing.T) {
+	s, err := store.OpenFile(filepath.Join(t.TempDir(), "games.jsonl"))
+	assert.NoError(t, err)
+	defer s.Close()
+	l := NewLobby(WithStore(s))
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60})
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+	playMove(t, blackConn, black, "e7e5", whiteConn, blackConn)
+	sendMessage(t, whiteConn, &Inbound{Action: RESIGN, PlayerID: white})
+	receiveAction(t, whiteConn, RESIGN)
+
+	var games []store.Game
+	assert.Eventually(t, func() bool {
+		games, _ = s.Find(store.Query{Player: l.Handle(white)})
+		return len(games) == 1
+	}, time.Second, 10*time.Millisecond)
+	g := games[0]
+	assert.Equal(t, l.Handle(white), g.White)
+	assert.Equal(t, l.Handle(black), g.Black)
+	assert.Equal(t, chess.BLACKWIN, g.Result)
+	assert.Equal(t, RESIGN, g.Termination)
+	assert.Equal(t, []string{"e4", "e5"}, g.Moves)
+	assert.Len(t, g.Clocks, 2)
+	assert.Equal(t, "60", g.TimeControl)
+}
+
+func TestRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := store.OpenJournal(path)
+	assert.NoError(t, err)
+	l := NewLobby(WithJournal(j))
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60})
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+	whiteTime := playMove(t, blackConn, black, "e7e5", whiteConn, blackConn).WhiteTime
+	running, _ := l.GetGameFromPlayerID(white)
+	assert.NoError(t, j.Close())
+
+	// restart the server from the journal
+	j, err = store.OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	restarted := NewLobby(WithJournal(j))
+	game, ok := restarted.GetGameFromPlayerID(white)
+	assert.True(t, ok)
+	assert.Equal(t, running.id, game.id)
+	assert.Equal(t, []string{"e4", "e5"}, game.board.Moves())
+	assert.Len(t, game.times, 3)
+	assert.InDelta(t, whiteTime, game.clock.Millis(whiteIndex, time.Now().Add(time.Minute)), 10, "clock runs while paused")
+
+	whiteConn = connect(t, restarted, game.id, white)
+	blackConn = connect(t, restarted, game.id, black)
+	receiveAction(t, whiteConn, GAME_START)
+	out := playMove(t, whiteConn, white, "g1f3", whiteConn, blackConn)
+	assert.Equal(t, "Nf3", out.Move)
+	sendMessage(t, blackConn, &Inbound{Action: RESIGN})
+	receiveAction(t, whiteConn, RESIGN)
+
+	assert.Eventually(t, func() bool {
+		j, err := store.OpenJournal(path)
+		if err != nil {
+			return false
+		}
+		defer j.Close()
+		return len(j.Unfinished()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRecoverPairing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := store.OpenJournal(path)
+	assert.NoError(t, err)
+	l := NewLobby(WithJournal(j))
+	options := GameOptions{TimeControl: FischerTimeControl(60, 0), Variant: STANDARD}
+	start := func(pairing Pairing) (*websocket.Conn, *websocket.Conn) {
+		gid, err := l.StartGame(pairing)
+		assert.NoError(t, err)
+		whiteConn := connect(t, l, gid, pairing.White)
+		blackConn := connect(t, l, gid, pairing.Black)
+		receiveAction(t, whiteConn, GAME_START)
+		receiveAction(t, blackConn, GAME_START)
+		return whiteConn, blackConn
+	}
+
+	white, black := GeneratePlayerID(), GeneratePlayerID()
+	whiteConn, blackConn := start(Pairing{White: white, Black: black, Options: options, Berserk: true})
+	sendMessage(t, blackConn, &Inbound{Action: BERSERK})
+	receiveAction(t, whiteConn, BERSERK)
+	playMove(t, whiteConn, white, "e2e4", whiteConn, blackConn)
+
+	played := GeneratePlayerID()
+	whiteConn, blackConn = start(Pairing{White: played, Black: GeneratePlayerID(), Options: options, Tournament: "tournament"})
+	playMove(t, whiteConn, played, "e2e4", whiteConn, blackConn)
+	assert.NoError(t, j.Close())
+
+	// the berserk clock is restored, the game of the tournament is not
+	j, err = store.OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	restarted := NewLobby(WithJournal(j))
+	game, ok := restarted.GetGameFromPlayerID(white)
+	assert.True(t, ok)
+	assert.Equal(t, [2]bool{false, true}, game.berserked)
+	assert.InDelta(t, 30000, game.clock.Millis(blackIndex, time.Now()), 10)
+	assert.Equal(t, 30000, game.times[0][blackIndex], "a takeback gives back the berserk time")
+	_, ok = restarted.GetGameFromPlayerID(played)
+	assert.False(t, ok)
+
+	reopened, err := store.OpenJournal(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	unfinished := reopened.Unfinished()
+	assert.Len(t, unfinished, 1)
+	assert.Equal(t, string(game.id), unfinished[0][0].Game)
+}
+
+func TestShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := store.OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	l := NewLobby(WithJournal(j))
+	finishing, finishingBlack, _, _ := startGame(t, l, GameRequest{Time: 60})
+	stopped, stoppedBlack, white, _ := startGame(t, l, GameRequest{Time: 60})
+	playMove(t, stopped, white, "e2e4", stopped, stoppedBlack)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	shutdown := make(chan error)
+	go func() { shutdown <- l.Shutdown(ctx) }()
+
+	for _, conn := range []*websocket.Conn{finishing, finishingBlack, stopped, stoppedBlack} {
+		out := receiveAction(t, conn, SHUTDOWN)
+		assert.Contains(t, out.Message, "continue after the restart")
+	}
+	assert.Equal(t, GameID(""), l.Match(&GameRequest{PlayerID: GeneratePlayerID()}).GameID, "no new games while draining")
+	sendMessage(t, finishing, &Inbound{Action: RESIGN})
+	receiveAction(t, finishing, RESIGN)
+
+	assert.ErrorIs(t, <-shutdown, context.DeadlineExceeded)
+	for {
+		if _, _, err := stopped.ReadMessage(); err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), err)
+			break
+		}
+	}
+
+	j, err = store.OpenJournal(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	unfinished := j.Unfinished()
+	assert.Len(t, unfinished, 1, "the resigned game finished")
+	assert.Equal(t, store.MOVE, unfinished[0][1].Kind)
+}
+
+func TestRunWhileDraining(t *testing.T) {
+	l := NewLobby()
+	assert.NoError(t, l.Shutdown(context.Background()))
+
+	pid := GeneratePlayerID()
+	game := newGame(l, defaultGameOptions, generateGameID())
+	l.Join(pid, game)
+	assert.False(t, l.run(game))
+	_, ok := game.takeSeat(pid, -1, "")
+	assert.False(t, ok, "the game never runs")
+	assert.Eventually(t, func() bool {
+		_, playing := l.GetGameFromPlayerID(pid)
+		_, running := l.GetGameFromGameID(game.id)
+		return !playing && !running
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSlowSpectator(t *testing.T) {
+	defer func(n int) { sendBuffer = n }(sendBuffer)
+	sendBuffer = 3
+	l := NewLobby()
+	whiteConn, blackConn, white, black := startGame(t, l, GameRequest{Time: 60})
+	game, _ := l.GetGameFromPlayerID(white)
+
+	// a spectator whose socket is never written to stalls like a dead client
+	conns := make(chan *websocket.Conn, 1)
+	s, client := newWSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		assert.NoError(t, err)
+		conns <- conn
+	}))
+	defer s.Close()
+	defer client.Close()
+	spectator := NewPlayer(l, <-conns, game)
+	spectator.id = GeneratePlayerID()
+	spectator.spectator = true
+	game.join <- spectator
+
+	for _, move := range []string{"e2e4", "e7e5", "g1f3", "b8c6"} {
+		conn, pid := whiteConn, white
+		if move[1] == '7' || move[1] == '8' {
+			conn, pid = blackConn, black
+		}
+		playMove(t, conn, pid, move, whiteConn, blackConn)
+	}
+
+	_, _, err := client.ReadMessage()
+	assert.Error(t, err, "the spectator was disconnected")
+	_, ok := <-spectator.send // the queue is closed once it is drained
+	for ok {
+		_, ok = <-spectator.send
+	}
+}
+
+func TestCoalesceTimeUpdates(t *testing.T) {
+	g := &Game{}
+	p := NewPlayer(nil, nil, g)
+	for i := range 5 {
+		g.deliver(p, &Outbound{Action: TIME_UPDATE, WhiteTime: i})
+	}
+	assert.Len(t, p.send, 0)
+	assert.Len(t, p.timeReady, 1)
+	assert.Equal(t, 4, p.pendingTime.Load().WhiteTime)
+
+	g.deliver(p, &Outbound{Action: MOVE_SUCCESS})
+	assert.Len(t, p.send, 1)
+	assert.Nil(t, p.pendingTime.Load(), "moves carry newer times")
+}
+
+func TestStartGame(t *testing.T) {
+	l := NewLobby()
+	white, black := GeneratePlayerID(), GeneratePlayerID()
+	results := make(chan GameResult, 1)
+	_, err := l.StartGame(Pairing{White: white, Black: white, Options: defaultGameOptions})
+	assert.Error(t, err)
+	gid, err := l.StartGame(Pairing{
+		White:   white,
+		Black:   black,
+		Options: GameOptions{TimeControl: FischerTimeControl(60, 0), Variant: STANDARD},
+		Berserk: true,
+		OnEnd:   func(result GameResult) { results <- result },
+	})
+	assert.NoError(t, err)
+	_, err = l.StartGame(Pairing{White: white, Black: GeneratePlayerID(), Options: defaultGameOptions})
+	assert.ErrorIs(t, err, ErrPlayerBusy)
+
+	whiteConn := connect(t, l, gid, white)
+	blackConn := connect(t, l, gid, black)
+	assert.Equal(t, chess.WHITE, receiveAction(t, whiteConn, GAME_START).Player)
+	assert.Equal(t, chess.BLACK, receiveAction(t, blackConn, GAME_START).Player)
+
+	sendMessage(t, blackConn, &Inbound{Action: BERSERK})
+	out := receiveAction(t, whiteConn, BERSERK)
+	assert.Equal(t, chess.BLACK, out.Player)
+	assert.Equal(t, 30000, out.BlackTime)
+
+	sendMessage(t, whiteConn, &Inbound{Action: RESIGN})
+	result := <-results
+	assert.Equal(t, chess.BLACKWIN, result.Result)
+	assert.Equal(t, [2]bool{true, true}, result.Joined)
+	assert.Equal(t, [2]bool{false, true}, result.Berserk)
+
+	// an armageddon gives black less time, and tournament games cannot be aborted
+	gid, err = l.StartGame(Pairing{
+		White:   white,
+		Black:   black,
+		Options: GameOptions{TimeControl: FischerTimeControl(60, 0), Variant: STANDARD},
+		Time:    [2]time.Duration{time.Minute, 45 * time.Second},
+		OnEnd:   func(result GameResult) { results <- result },
+	})
+	assert.NoError(t, err)
+	whiteConn = connect(t, l, gid, white)
+	blackConn = connect(t, l, gid, black)
+	out = receiveAction(t, whiteConn, GAME_START)
+	assert.InDelta(t, 60000, out.WhiteTime, 1000)
+	assert.Equal(t, 45000, out.BlackTime)
+	sendMessage(t, whiteConn, &Inbound{Action: ABORT})
+	sendMessage(t, blackConn, &Inbound{Action: RESIGN})
+	assert.Equal(t, RESIGN, (<-results).Termination)
+}
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+var (
+	maxLagCredit    = 500 * time.Millisecond // most network lag credited back for one move
+	lagQuotaInitial = time.Second            // lag credit available at the start of a game
+	lagQuotaGain    = 100 * time.Millisecond // lag credit earned with every move
+	lagQuotaMax     = 2 * time.Second
+)
+
+// pingPayload returns the time since the connection was opened, which
+// the client echoes back in its pong
+func (p *Player) pingPayload() []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(time.Since(p.epoch)))
+	return payload
+}
+
+// handlePong updates the round trip time estimate from a pong echoing
+// a ping sent by write. Pongs with unexpected payloads are ignored.
+func (p *Player) handlePong(data string) {
+	if len(data) != 8 {
+		return
+	}
+	sent := time.Duration(binary.BigEndian.Uint64([]byte(data)))
+	rtt := time.Since(p.epoch) - sent
+	if rtt < 0 {
+		return
+	}
+	if previous := time.Duration(p.rtt.Load()); previous > 0 {
+		rtt = (3*previous + rtt) / 4 // smooth out spikes
+	}
+	p.rtt.Store(int64(rtt))
+}
+
+// Lag returns the estimated one way network delay of the connection
+func (p *Player) Lag() time.Duration {
+	return time.Duration(p.rtt.Load()) / 2
+}
+
+// lagCredit returns how much of a move that took elapsed should be
+// given back to the player at index for network lag. Credit is bounded
+// per move and by a quota that refills slowly with every move, so a
+// player cannot gain time by faking a slow connection.
+func (g *Game) lagCredit(index int, elapsed time.Duration) time.Duration {
+	g.lagQuota[index] = min(g.lagQuota[index]+lagQuotaGain, lagQuotaMax)
+	player := g.players[index]
+	if player == nil {
+		return 0
+	}
+	credit := min(player.Lag(), maxLagCredit, elapsed, g.lagQuota[index])
+	g.lagQuota[index] -= credit
+	return credit
+}
+
+// lagMillis returns the lag of the player at index in milliseconds,
+// or 0 if they are not connected
+func (g *Game) lagMillis(index int) int {
+	if player := g.players[index]; player != nil {
+		return int(player.Lag().Milliseconds())
+	}
+	return 0
+}
@@ -1,70 +1,239 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
+	"github.com/JDRadatti/reptile/internal/auth"
 	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/JDRadatti/reptile/internal/store"
 	"log"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	gameLimit = 10
 )
 
+var errLoginRequired = errors.New("player has an account, log in to play")
+
+// Lobby matches players into games and keeps track of running games.
+//
+// A Lobby is safe for concurrent use by HTTP handlers, websocket
+// handshakes and game loops. Each Game is owned by its play goroutine,
+// the only one that touches its state, and everyone else talks to it
+// through its channels. The lobby's maps are guarded by mu, the pools by
+// poolMu, the seek board connections by watchMu and the notification
+// connections by notifyMu. poolMu can be taken while holding mu or
+// watchMu, not the other way around, no lock is taken while holding
+// notifyMu and none is held while waiting on a game, since games call
+// back into the lobby when they end.
 type Lobby struct {
-	Games    map[GameID]*Game   // Current running games (has both players)
-	Players  map[PlayerID]*Game // Current Players in a game.
-	GamePool chan *Game         // Current waiting games (only one player)
+	Tolerance float64 // how different paired time controls can be, see TimeControl.Similar
+	Ratings   *rating.Ratings
+	Accounts  *auth.Accounts
+	Signer    *auth.Signer
+	Store     store.Store        // archive of finished games, nil to not keep them
+	Journal   *store.Journal     // log of running games to recover after a restart, nil to not keep one
+	colors    *colorHistory      // recent colors of players, to balance colors in rated games
+	games     map[GameID]*Game   // Current running games (has both players)
+	players   map[PlayerID]*Game // Current Players in a game.
+	mu        sync.RWMutex
+	pools     map[PoolKey]*pool // Current waiting games (only one player)
+	poolMu    sync.Mutex
+
+	seekUpdates chan struct{} // signals the seeks changed, see broadcastSeeks
+	watchers    map[*seekWatcher]struct{}
+	watchMu     sync.Mutex
+
+	challenges map[ChallengeID]*challenge        // open direct challenges, guarded by mu
+	notifiers  map[string]map[*notifier]struct{} // open connections by handle
+	notifyMu   sync.Mutex
+
+	running         sync.WaitGroup // game loops that have not returned
+	runMu           sync.Mutex     // orders run against closing draining
+	draining        chan struct{}  // closed when Shutdown is called
+	stopping        chan struct{}  // closed when games must stop, see Shutdown
+	shutdownOnce    sync.Once
+	stopOnce        sync.Once
+	shutdownMessage string
 }
 
-func NewLobby() *Lobby {
-	return &Lobby{
-		Games:    make(map[GameID]*Game),
-		Players:  make(map[PlayerID]*Game),
-		GamePool: make(chan *Game, gameLimit),
+// LobbyOption configures a Lobby created with NewLobby
+type LobbyOption func(*Lobby)
+
+// WithRatings keeps the ratings of players in r instead of a new
+// rating.Ratings
+func WithRatings(r *rating.Ratings) LobbyOption {
+	return func(l *Lobby) {
+		l.Ratings = r
 	}
 }
 
-func (l *Lobby) Clean(gid GameID, pid1 PlayerID, pid2 PlayerID) {
-	if _, ok := l.Games[gid]; ok {
-		delete(l.Games, gid)
+// WithAuth verifies players with accounts and tokens signed by signer
+// instead of in memory accounts and a random key
+func WithAuth(accounts *auth.Accounts, signer *auth.Signer) LobbyOption {
+	return func(l *Lobby) {
+		l.Accounts = accounts
+		l.Signer = signer
+	}
+}
+
+// WithStore archives finished games in s
+func WithStore(s store.Store) LobbyOption {
+	return func(l *Lobby) {
+		l.Store = s
+	}
+}
+
+// WithJournal logs running games to j and recovers the games left
+// unfinished in it
+func WithJournal(j *store.Journal) LobbyOption {
+	return func(l *Lobby) {
+		l.Journal = j
+	}
+}
+
+// WithTolerance pairs players whose time controls are within tolerance
+// instead of only identical time controls
+func WithTolerance(tolerance float64) LobbyOption {
+	return func(l *Lobby) {
+		l.Tolerance = tolerance
+	}
+}
+
+func NewLobby(options ...LobbyOption) *Lobby {
+	accounts, _ := auth.NewAccounts("")
+	l := &Lobby{
+		games:    make(map[GameID]*Game),
+		players:  make(map[PlayerID]*Game),
+		pools:    make(map[PoolKey]*pool),
+		Ratings:  rating.NewRatings(),
+		Accounts: accounts,
+		Signer:   auth.NewSigner(nil),
+		colors:   newColorHistory(),
+		draining: make(chan struct{}),
+		stopping: make(chan struct{}),
+
+		seekUpdates: make(chan struct{}, 1),
+		watchers:    make(map[*seekWatcher]struct{}),
+
+		challenges: make(map[ChallengeID]*challenge),
+		notifiers:  make(map[string]map[*notifier]struct{}),
+	}
+	for _, option := range options {
+		option(l)
 	}
-	if _, ok := l.Players[pid1]; ok {
-		delete(l.Players, pid1)
+	l.recover()
+	go l.broadcastSeeks()
+	go l.pairPools()
+	return l
+}
+
+// Authenticate returns the id of the player of a session or seat token.
+// Player ids are secret, the id sent in a message is never trusted.
+func (l *Lobby) Authenticate(token string) (PlayerID, error) {
+	if subject, err := l.Signer.Verify(auth.SESSION, token); err == nil {
+		return PlayerID(subject), nil
 	}
-	if _, ok := l.Players[pid2]; ok {
-		delete(l.Players, pid2)
+	subject, err := l.Signer.Verify(auth.SEAT, token)
+	if err != nil {
+		return "", err
+	} else if l.Accounts.Registered(subject) {
+		return "", errLoginRequired
+	}
+	return PlayerID(subject), nil
+}
+
+// SeatToken returns a new token for the anonymous player pid
+func (l *Lobby) SeatToken(pid PlayerID) string {
+	return l.Signer.Sign(auth.SEAT, string(pid), time.Now().Add(auth.SeatDuration))
+}
+
+// Handle returns the public name of pid shown to other players: the
+// username of an account, or a handle derived from the id
+func (l *Lobby) Handle(pid PlayerID) string {
+	if account, ok := l.Accounts.Get(string(pid)); ok {
+		return account.Username
 	}
+	return l.Signer.Handle(string(pid))
+}
+
+func (l *Lobby) Clean(gid GameID, pid1 PlayerID, pid2 PlayerID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.games, gid)
+	delete(l.players, pid1)
+	delete(l.players, pid2)
 }
 
 func (l *Lobby) GetGameFromGameID(id GameID) (*Game, bool) {
-	game, ok := l.Games[id]
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	game, ok := l.games[id]
 	return game, ok
 }
 
 func (l *Lobby) GetGameFromPlayerID(id PlayerID) (*Game, bool) {
-	player, ok := l.Players[id]
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	player, ok := l.players[id]
 	return player, ok
 }
 
 func (l *Lobby) Join(playerID PlayerID, game *Game) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.join(playerID, game)
+}
+
+// join is Join with mu held
+func (l *Lobby) join(playerID PlayerID, game *Game) bool {
 	if game == nil {
 		return false
 	}
-	if _, ok := l.Players[playerID]; ok {
+	if _, ok := l.players[playerID]; ok {
 		return false
 	}
-	l.Players[playerID] = game
+	l.players[playerID] = game
 
-	if _, ok := l.Games[game.id]; !ok {
-		l.Games[game.id] = game
+	if _, ok := l.games[game.id]; !ok {
+		l.games[game.id] = game
 	}
 	return true
 }
 
+// joinBoth adds both players to game, or neither if one of them is
+// already in a game. Returns the busy player.
+func (l *Lobby) joinBoth(white PlayerID, black PlayerID, game *Game) (PlayerID, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pid := range []PlayerID{white, black} {
+		if _, ok := l.players[pid]; ok {
+			return pid, false
+		}
+	}
+	l.join(white, game)
+	l.join(black, game)
+	return "", true
+}
+
+// leave removes playerID from game if they did not get a seat
+func (l *Lobby) leave(playerID PlayerID, game *Game) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.players[playerID] == game {
+		delete(l.players, playerID)
+	}
+}
+
 func (l *Lobby) Success(pid PlayerID, gid GameID, i int) *GameResponse {
 	return &GameResponse{
 		PlayerID: pid,
+		Handle:   l.Handle(pid),
+		Token:    l.SeatToken(pid),
 		GameID:   gid,
 		Player:   chess.Player(i),
 	}
@@ -78,15 +247,22 @@ func (l *Lobby) Fail() *GameResponse {
 	}
 }
 
+// String describes the games of the lobby and who is in them. Players
+// are shown by their handle, their ids are secret.
 func (l *Lobby) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	seated := make(map[GameID][]PlayerID)
+	for pid, game := range l.players {
+		seated[game.id] = append(seated[game.id], pid)
+	}
 	builder := strings.Builder{}
-	builder.WriteString(fmt.Sprintf("#games %d, #players %d, #gamepool %d\n", len(l.Games), len(l.Players), len(l.GamePool)))
-	for _, game := range l.Games {
-		builder.WriteString(fmt.Sprintf("-- %s --\n", string(game.id)))
-		for i, pid := range game.playerIDs {
-			if pid != "" {
-				builder.WriteString(fmt.Sprintf("%d %s\n", i, string(pid)))
-			}
+	builder.WriteString(fmt.Sprintf("#games %d, #players %d, #gamepool %d\n", len(l.games), len(l.players), l.waiting()))
+	for id := range l.games {
+		builder.WriteString(fmt.Sprintf("-- %s --\n", string(id)))
+		for _, pid := range seated[id] {
+			builder.WriteString(fmt.Sprintf("%s\n", l.Handle(pid)))
 		}
 	}
 
@@ -94,33 +270,57 @@ func (l *Lobby) String() string {
 }
 
 func (l *Lobby) Match(request *GameRequest) *GameResponse {
+	if l.Draining() {
+		return l.Fail()
+	}
 	if game, ok := l.GetGameFromPlayerID(request.PlayerID); ok {
 		log.Printf("player %s already in game %s", request.PlayerID, game.id)
-		if index, ok := game.playerIndex(request.PlayerID); ok {
+		if index, ok := game.takeSeat(request.PlayerID, -1, ""); ok {
 			return l.Success(request.PlayerID, game.id, index)
 		} else {
 			return l.Fail()
 		}
 	}
-	// TODO: handle different game options
+	options := request.Options()
+	taker := l.newSeek(request, options)
+
+	l.mu.Lock()
+	if _, ok := l.players[request.PlayerID]; ok { // matched by a concurrent request
+		l.mu.Unlock()
+		return l.Fail()
+	}
 	var game *Game
-	select {
-	case g := <-l.GamePool:
-		if g.state == over {
-			game = NewGame(l, request.Time, request.Increment)
-			l.GamePool <- game
-		} else {
-			game = g
+	color := request.colorIndex()
+	if s, ok := l.takeFromPool(options, taker); ok {
+		game, color = s.game, l.takerColor(s, taker)
+	} else {
+		game = NewGame(l, options)
+		taker.game = game
+		if !l.addToPool(taker) {
+			log.Printf("game pool full, game %s can only be joined by link", game.id)
 		}
-	default:
-		game = NewGame(l, request.Time, request.Increment)
-		l.GamePool <- game
 	}
+	l.join(request.PlayerID, game)
+	l.mu.Unlock()
 
-	if index, ok := game.addPlayerID(request.PlayerID); ok {
-		l.Join(request.PlayerID, game)
-		return l.Success(request.PlayerID, game.id, index)
-	} else {
-		return l.Fail()
+	return l.seat(request.PlayerID, game, color, taker.color)
+}
+
+// seat seats pid, with the color preference pref, in game, which they
+// joined in the lobby, see Game.seatPlayerID
+func (l *Lobby) seat(pid PlayerID, game *Game, color int, pref string) *GameResponse {
+	if index, ok := game.takeSeat(pid, color, pref); ok {
+		return l.Success(pid, game.id, index)
+	}
+	l.leave(pid, game)
+	return l.Fail()
+}
+
+// waiting returns the number of games waiting for a second player
+func (l *Lobby) waiting() int {
+	count := 0
+	for _, pool := range l.Pools() {
+		count += pool.Waiting
 	}
+	return count
 }
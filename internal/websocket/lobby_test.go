@@ -0,0 +1,271 @@
+package websocket
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTimeControl(t *testing.T) {
+	l := NewLobby(WithTolerance(0.1))
+	request := func(time, increment int) *GameResponse {
+		return l.Match(&GameRequest{PlayerID: GeneratePlayerID(), Time: time, Increment: increment})
+	}
+
+	blitz := request(300, 2)
+	bullet := request(60, 0)
+	assert.NotEqual(t, blitz.GameID, bullet.GameID)
+	assert.Equal(t, bullet.GameID, request(60, 0).GameID)
+	assert.Equal(t, blitz.GameID, request(290, 2).GameID)
+	assert.Empty(t, l.Pools())
+}
+
+func TestLobbyString(t *testing.T) {
+	l := NewLobby()
+	pid := GeneratePlayerID()
+	l.Match(&GameRequest{PlayerID: pid, Time: 60})
+	assert.Contains(t, l.String(), l.Handle(pid))
+	assert.NotContains(t, l.String(), string(pid))
+}
+
+func TestPools(t *testing.T) {
+	l := NewLobby()
+	for _, request := range []*GameRequest{
+		{Time: 60},
+		{Time: 600},
+		{Time: 600},
+		{Time: 600, Variant: STANDARD},
+		{Time: 600, Increment: 5},
+	} {
+		request.PlayerID = GeneratePlayerID()
+		l.Match(request)
+	}
+
+	assert.Equal(t, []PoolStatus{
+		{Variant: STANDARD, TimeControl: "60", Waiting: 1},
+		{Variant: STANDARD, TimeControl: "600", Waiting: 1},
+		{Variant: STANDARD, TimeControl: "600+5", Waiting: 1},
+	}, l.Pools())
+	assert.Error(t, (&GameRequest{Time: 600, Variant: "atomic"}).Validate())
+}
+
+// rated returns a new player who won wins, or lost -wins, rated blitz
+// games against new players
+func rated(l *Lobby, wins int) PlayerID {
+	pid := GeneratePlayerID()
+	score := 1.0
+	if wins < 0 {
+		wins, score = -wins, 0
+	}
+	for range wins {
+		l.Ratings.Record(rating.BLITZ, l.Handle(pid), l.Handle(GeneratePlayerID()), score)
+	}
+	return pid
+}
+
+func TestMatchRating(t *testing.T) {
+	ratings := rating.NewRatings()
+	l := NewLobby(WithRatings(ratings))
+	request := func(wins int) *GameResponse {
+		return l.Match(&GameRequest{PlayerID: rated(l, wins), Time: 300, Rated: true})
+	}
+
+	weak := request(-1)
+	strong := request(1)
+	assert.NotEqual(t, weak.GameID, strong.GameID)
+
+	// the oldest seek in range is taken first
+	older := request(1)
+	assert.Equal(t, strong.GameID, older.GameID)
+
+	// windows widen while waiting
+	key := PoolKey{Variant: STANDARD, TimeControl: "300", Rated: true}
+	assert.NotEqual(t, weak.GameID, request(0).GameID)
+	l.poolMu.Lock()
+	l.pools[key].seeks[0].since = time.Now().Add(-30 * time.Second)
+	l.poolMu.Unlock()
+	assert.Equal(t, weak.GameID, request(0).GameID)
+
+	// and nobody waits forever
+	l.poolMu.Lock()
+	l.pools[key].seeks[0].since = time.Now().Add(-ratingWindowMaxWait)
+	l.poolMu.Unlock()
+	assert.Equal(t, 1, l.Pools()[0].Waiting)
+	request(3)
+	assert.Empty(t, l.Pools())
+}
+
+func TestPairWaiting(t *testing.T) {
+	l := NewLobby()
+	request := func(wins int) (PlayerID, *GameResponse) {
+		pid := rated(l, wins)
+		return pid, l.Match(&GameRequest{PlayerID: pid, Time: 300, Rated: true})
+	}
+	weak, older := request(-1)
+	strong, newer := request(1)
+	assert.NotEqual(t, older.GameID, newer.GameID)
+	weakConn := connect(t, l, older.GameID, weak)
+	strongConn := connect(t, l, newer.GameID, strong)
+
+	// out of each other's window at first
+	l.pairWaiting(time.Now())
+	assert.Equal(t, 2, l.Pools()[0].Waiting)
+
+	// the windows widen and the newer player moves to the older game
+	l.pairWaiting(time.Now().Add(30 * time.Second))
+	assert.Empty(t, l.Pools())
+	out := receiveAction(t, strongConn, JOIN_SUCCESS)
+	assert.Equal(t, older.GameID, out.GameID)
+	receiveAction(t, weakConn, GAME_START)
+	receiveAction(t, strongConn, GAME_START)
+	game, ok := l.GetGameFromPlayerID(strong)
+	assert.True(t, ok)
+	assert.Equal(t, older.GameID, game.ID())
+	assert.Eventually(t, func() bool {
+		_, ok := l.GetGameFromGameID(newer.GameID)
+		return !ok
+	}, time.Second, 10*time.Millisecond, "the newer game is over")
+
+	// casual pools ignore ratings
+	casual := l.Match(&GameRequest{PlayerID: rated(l, -2), Time: 300})
+	assert.Equal(t, casual.GameID, l.Match(&GameRequest{PlayerID: rated(l, 2), Time: 300}).GameID)
+}
+
+func TestRatingWindow(t *testing.T) {
+	assert.Equal(t, ratingWindowBase, window(0))
+	assert.Less(t, window(time.Second), window(10*time.Second))
+	assert.Equal(t, math.MaxInt, window(ratingWindowMaxWait))
+}
+
+// TestConcurrentMatches matches and ends many games at once, run with
+// -race to check the lobby's locking
+func TestConcurrentMatches(t *testing.T) {
+	l := NewLobby()
+	const players = 40
+	pids := make([]PlayerID, players)
+	responses := make([]*GameResponse, players)
+	var wg sync.WaitGroup
+	for i := range players {
+		pids[i] = GeneratePlayerID()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = l.Match(&GameRequest{PlayerID: pids[i], Time: 60 * (1 + i%2)})
+		}()
+	}
+	wg.Wait()
+
+	games := make(map[GameID]bool)
+	for _, response := range responses {
+		games[response.GameID] = true
+	}
+	assert.Len(t, games, players/2)
+	assert.Empty(t, l.Pools())
+
+	conns := make([]*websocket.Conn, players)
+	for i, response := range responses {
+		conns[i] = connect(t, l, response.GameID, pids[i])
+	}
+	seats := make(map[GameID][]chess.Player)
+	for i, response := range responses {
+		// a waiting player may be moved to the other seat, GAME_START is final
+		start := receiveAction(t, conns[i], GAME_START)
+		seats[response.GameID] = append(seats[response.GameID], start.Player)
+	}
+	for _, seated := range seats {
+		assert.ElementsMatch(t, []chess.Player{chess.WHITE, chess.BLACK}, seated)
+	}
+	for i := range players {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			action := RESIGN
+			if i%2 == 0 {
+				action = ABORT
+			}
+			conns[i].WriteJSON(&Inbound{Action: action})
+		}()
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		for _, pid := range pids {
+			if _, ok := l.GetGameFromPlayerID(pid); ok {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestColorPreference(t *testing.T) {
+	l := NewLobby()
+	match := func(color string) (PlayerID, *GameResponse) {
+		pid := GeneratePlayerID()
+		return pid, l.Match(&GameRequest{PlayerID: pid, Time: 60, Color: color})
+	}
+	seatOf := func(pid PlayerID, gameID GameID) int {
+		game, ok := l.GetGameFromGameID(gameID)
+		assert.True(t, ok)
+		index, ok := game.takeSeat(pid, -1, "")
+		assert.True(t, ok)
+		return index
+	}
+
+	// players asking for the same color are not paired
+	_, white := match(WHITE)
+	_, other := match(WHITE)
+	assert.NotEqual(t, white.GameID, other.GameID)
+	blackID, black := match(BLACK)
+	assert.Equal(t, white.GameID, black.GameID)
+	assert.Equal(t, blackIndex, seatOf(blackID, black.GameID))
+	_, random := match(RANDOM)
+	assert.Equal(t, other.GameID, random.GameID)
+	assert.Empty(t, l.Pools())
+
+	// a flexible player gives up their seat to a player with a preference
+	flexibleID, flexible := match("")
+	color := WHITE // ask for the seat the flexible player has
+	if seatOf(flexibleID, flexible.GameID) == blackIndex {
+		color = BLACK
+	}
+	takerID, taker := match(color)
+	assert.Equal(t, flexible.GameID, taker.GameID)
+	assert.NotEqual(t, seatOf(flexibleID, flexible.GameID), seatOf(takerID, taker.GameID))
+}
+
+func TestColorHistory(t *testing.T) {
+	h := newColorHistory()
+	now := time.Now()
+	for range colorHistoryLength + 5 {
+		h.record("a", whiteIndex, now)
+	}
+	balance, last := h.balance("a")
+	assert.Equal(t, colorHistoryLength, balance)
+	assert.Equal(t, whiteIndex, last)
+
+	// whoever had white more often gets black
+	h.record("b", whiteIndex, now)
+	assert.Equal(t, blackIndex, h.fairer("a", "b"))
+	assert.Equal(t, whiteIndex, h.fairer("b", "a"))
+
+	// then whoever had white last
+	h.record("c", blackIndex, now)
+	h.record("c", whiteIndex, now)
+	h.record("d", whiteIndex, now)
+	h.record("d", blackIndex, now)
+	assert.Equal(t, blackIndex, h.fairer("c", "d"))
+	assert.Equal(t, whiteIndex, h.fairer("d", "c"))
+
+	// players who stopped playing are forgotten
+	h.record("d", whiteIndex, now.Add(colorHistoryExpiry))
+	assert.Len(t, h.colors, 1)
+	balance, _ = h.balance("d")
+	assert.Equal(t, 1, balance)
+}
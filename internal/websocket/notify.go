@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"encoding/json"
+	"github.com/JDRadatti/reptile/internal/auth"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	notifyBuffer = 8 // notifications a connection can fall behind before missing some
+)
+
+// Notification is sent to every open connection of a player, on the
+// notifications websocket and on game connections
+type Notification struct {
+	Action     string           // one of CHALLENGE, CHALLENGE_ACCEPT, ...
+	GameID     GameID           `json:",omitempty"`
+	Challenge  *ChallengeStatus `json:",omitempty"`
+	Tournament string           `json:",omitempty"` // id of the tournament of a TOURNAMENT_GAME
+}
+
+// notifier is an open connection of a player that receives the
+// notifications sent to their handle
+type notifier struct {
+	send chan *Notification
+}
+
+// subscribe returns a notifier for a new connection of handle
+func (l *Lobby) subscribe(handle string) *notifier {
+	n := &notifier{send: make(chan *Notification, notifyBuffer)}
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	if l.notifiers[handle] == nil {
+		l.notifiers[handle] = make(map[*notifier]struct{})
+	}
+	l.notifiers[handle][n] = struct{}{}
+	return n
+}
+
+func (l *Lobby) unsubscribe(handle string, n *notifier) {
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	delete(l.notifiers[handle], n)
+	if len(l.notifiers[handle]) == 0 {
+		delete(l.notifiers, handle)
+	}
+}
+
+// online returns true iff handle has an open connection
+func (l *Lobby) online(handle string) bool {
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	return len(l.notifiers[handle]) > 0
+}
+
+// Notify sends note to every open connection of handle. It never
+// blocks, a connection too far behind misses the notification.
+func (l *Lobby) Notify(handle string, note *Notification) {
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	for n := range l.notifiers[handle] {
+		select {
+		case n.send <- note:
+		default:
+			log.Printf("notification %s to %s dropped", note.Action, handle)
+		}
+	}
+}
+
+// NotificationsHandler serves the notifications websocket of a player,
+// authenticated like a game connection by the token of the first
+// message or the request. Every challenge of the player is sent when the
+// connection opens, game connections only get new notifications.
+type NotificationsHandler struct {
+	Lobby *Lobby
+}
+
+func (h *NotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	token := auth.RequestToken(r)
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	if in, ok := unmarshal(message); ok && in.Token != "" {
+		token = in.Token
+	}
+	pid, err := h.Lobby.Authenticate(token)
+	if err != nil {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "invalid token"))
+		return
+	}
+
+	handle := h.Lobby.Handle(pid)
+	n := h.Lobby.subscribe(handle)
+	defer h.Lobby.unsubscribe(handle, n)
+	for _, c := range h.Lobby.Challenges(pid) {
+		if !writeNotification(conn, &Notification{Action: CHALLENGE, Challenge: &c}) {
+			return
+		}
+	}
+
+	// read only to notice the connection closing and answer pings
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(maxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pongWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case note := <-n.send:
+			if !writeNotification(conn, note) {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-h.Lobby.draining:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+// writeNotification writes note to conn, returns false if the connection
+// failed
+func writeNotification(conn *websocket.Conn, note *Notification) bool {
+	message, err := json.Marshal(note)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return true
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteMessage(messageType, message) == nil
+}
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"errors"
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/store"
+	"time"
+)
+
+// ErrPlayerBusy is returned by StartGame when a player is already in a
+// game
+var ErrPlayerBusy = errors.New("player is already in a game")
+
+// Pairing is a game between two given players, like the games of a
+// tournament, started with StartGame
+type Pairing struct {
+	White   PlayerID
+	Black   PlayerID
+	Options GameOptions
+	Berserk bool             // players can halve their clock before their first move, see BERSERK
+	Wait    time.Duration    // how long players have to connect, maxWaitTime if 0
+	Time    [2]time.Duration // time white and black start with, like in an armageddon, the time control's if zero
+	OnEnd   func(GameResult) // called by the game loop when the game is over, it must not block
+
+	// Tournament is the id of the tournament of the game. Its games are
+	// not recovered after a restart, since tournaments are not.
+	Tournament string
+}
+
+// GameResult is how a game of a Pairing ended
+type GameResult struct {
+	GameID      GameID
+	White       PlayerID
+	Black       PlayerID
+	Result      string  // chess.WHITEWIN, chess.BLACKWIN, chess.DRAW or "" if the game was not played
+	Termination string  // action of the end message
+	Plies       int     // half moves played
+	Joined      [2]bool // whether white and black connected to the game
+	Berserk     [2]bool // whether white and black went berserk
+}
+
+// StartGame starts the game of p. The players are seated in their colors
+// and told where to play by the caller, the game cannot be aborted and
+// there is no rematch after it.
+func (l *Lobby) StartGame(p Pairing) (GameID, error) {
+	if l.Draining() {
+		return "", errShuttingDown
+	}
+	options := p.Options
+	if err := options.Validate(); err != nil {
+		return "", err
+	}
+	game := newGame(l, options, generateGameID())
+	game.playerIDs = [2]PlayerID{p.White, p.Black}
+	game.colorPrefs = [2]string{WHITE, BLACK}
+	game.berserkAllowed = p.Berserk
+	game.onEnd = p.OnEnd
+	game.tournament = p.Tournament
+	if p.Wait != 0 {
+		game.wait = p.Wait
+	}
+	if p.Time != [2]time.Duration{} {
+		game.clock.Restore(p.Time, [2]int{})
+	}
+
+	l.mu.Lock()
+	_, whiteBusy := l.players[p.White]
+	_, blackBusy := l.players[p.Black]
+	if whiteBusy || blackBusy || p.White == p.Black {
+		l.mu.Unlock()
+		return "", ErrPlayerBusy
+	}
+	l.join(p.White, game)
+	l.join(p.Black, game)
+	l.mu.Unlock()
+
+	if !l.run(game) {
+		return "", errShuttingDown
+	}
+	return game.id, nil
+}
+
+// gameResult returns the result reported to OnEnd, only the game loop
+// may call it
+func (g *Game) gameResult() GameResult {
+	return GameResult{
+		GameID:      g.id,
+		White:       g.playerIDs[whiteIndex],
+		Black:       g.playerIDs[blackIndex],
+		Result:      g.result,
+		Termination: g.termination,
+		Plies:       g.board.Plies(),
+		Joined:      g.joined,
+		Berserk:     g.berserked,
+	}
+}
+
+// goBerserk halves the clock of the player at index and takes away
+// their increment, if they have not moved yet
+func (g *Game) goBerserk(index int) {
+	if !g.berserkAllowed || g.berserked[index] || g.state == over || g.clock.Moves(index) > 0 {
+		return
+	}
+	g.berserked[index] = true
+	now := time.Now()
+	g.clock.Berserk(index, now)
+	if len(g.times) > 0 { // the time a takeback gives back is halved too
+		g.times[len(g.times)-1][index] = g.clock.Millis(index, now)
+	}
+	g.journal(store.Entry{Kind: store.BERSERK, Berserk: []bool{g.berserked[whiteIndex], g.berserked[blackIndex]}, Clocks: g.journalClocks(now)})
+	out := g.out(BERSERK, g.playerIDs[index])
+	out.Player = chess.Player(index)
+	g.sendAll(out)
+}
@@ -4,42 +4,47 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"log"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	messageType              = websocket.TextMessage
-	matchmakingMaxWait       = 180 // seconds
-	writeWait                = 10 * time.Second
-	pongWait                 = 60 * time.Second
-	pingPeriod               = (pongWait * 9) / 10
-	maxMessageSize     int64 = 512
+	messageType          = websocket.TextMessage
+	writeWait            = 10 * time.Second
+	pongWait             = 60 * time.Second
+	pingPeriod           = 2 * time.Second // pings also measure the round trip time
+	maxMessageSize int64 = 512
 )
 
 type PlayerID string
 
-func (pid PlayerID) validate() bool {
-	if err := uuid.Validate(string(pid)); err != nil {
-		return true
-	}
-	return false
-}
-
 type Player struct {
-	id    PlayerID
-	game  *Game
-	lobby *Lobby
-	conn  *websocket.Conn
-	send  chan *Outbound
+	id        PlayerID
+	game      atomic.Pointer[Game] // changed by a rematch
+	token     string               // seat token sent to a new anonymous player
+	lobby     *Lobby
+	conn      *websocket.Conn
+	send      chan *Outbound // see Game.deliver
+	spectator bool
+	epoch     time.Time    // when the connection was opened, used to time pings
+	rtt       atomic.Int64 // smoothed round trip time in nanoseconds
+
+	pendingTime atomic.Pointer[Outbound] // latest TIME_UPDATE not written yet
+	timeReady   chan struct{}            // signals pendingTime was set
+	closed      bool                     // send is closed, owned by the game loop
+	notifier    *notifier                // notifications of the player, nil for spectators
 }
 
 func NewPlayer(l *Lobby, c *websocket.Conn, g *Game) *Player {
-	return &Player{
-		lobby: l,
-		conn:  c,
-		game:  g,
-		send:  make(chan *Outbound),
+	p := &Player{
+		lobby:     l,
+		conn:      c,
+		send:      make(chan *Outbound, sendBuffer),
+		timeReady: make(chan struct{}, 1),
+		epoch:     time.Now(),
 	}
+	p.game.Store(g)
+	return p
 }
 
 func GeneratePlayerID() PlayerID {
@@ -55,48 +60,81 @@ func GeneratePlayerID() PlayerID {
 // concurrent write errors
 func (p *Player) write() {
 	ticker := time.NewTicker(pingPeriod)
+	var notes chan *Notification
+	if p.notifier != nil {
+		notes = p.notifier.send
+	}
 	defer func() {
 		ticker.Stop()
+		if p.notifier != nil {
+			p.lobby.unsubscribe(p.lobby.Handle(p.id), p.notifier)
+		}
 		p.conn.Close()
 	}()
 
 	for {
 		select {
-		case out := <-p.send:
-			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if message, ok := marshal(out); ok {
-				if err := p.conn.WriteMessage(messageType, message); err != nil {
-					log.Printf("error: %v", err)
-					return
-				}
+		case out, ok := <-p.send:
+			if !ok { // the game closed the channel
+				p.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				p.conn.WriteMessage(websocket.CloseMessage, p.closeMessage())
+				return
+			}
+			if !p.writeOut(out) {
+				return
+			}
+		case <-p.timeReady:
+			if out := p.pendingTime.Swap(nil); out != nil && !p.writeOut(out) {
+				return
+			}
+		case note := <-notes:
+			if !writeNotification(p.conn, note) {
+				return
 			}
 		case <-ticker.C:
 			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := p.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := p.conn.WriteMessage(websocket.PingMessage, p.pingPayload()); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// writeOut writes out to the websocket, returns false if the connection
+// failed
+func (p *Player) writeOut(out *Outbound) bool {
+	p.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if message, ok := marshal(out); ok {
+		if err := p.conn.WriteMessage(messageType, message); err != nil {
+			log.Printf("error: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
 // read message from the websocket and notify the Game
 // All reads from websocket MUST be in this function to avoid
 // concurrent read errors
 func (p *Player) read() {
 	defer func() {
-		p.game.leave <- p
+		game := p.game.Load()
+		select {
+		case game.leave <- p:
+		case <-game.done:
+		}
 		p.conn.Close()
 	}()
 
 	p.conn.SetReadLimit(maxMessageSize)
 	p.conn.SetReadDeadline(time.Now().Add(pongWait))
-	p.conn.SetPongHandler(func(string) error { p.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	p.conn.SetPongHandler(func(data string) error {
+		p.conn.SetReadDeadline(time.Now().Add(pongWait))
+		p.handlePong(data)
+		return nil
+	})
 
 	for {
-		if p.game.state != playing {
-			continue
-		}
-
 		_, message, err := p.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -106,23 +144,54 @@ func (p *Player) read() {
 		}
 
 		if in, ok := unmarshal(message); ok {
-			if p.id != in.PlayerID {
-				log.Println("invalid player id", p.id, in.PlayerID)
-				continue // Soft handle invalid ids
-			}
+			in.PlayerID = p.id // verified in the handshake, never trust the message
+			in.from = p
+			game := p.game.Load()
+			var ch chan *Inbound
 			switch in.Action {
 			case MOVE:
-				p.game.move <- in
+				fallthrough
+			case PREMOVE_CANCEL:
+				ch = game.move
 			case RESIGN:
-				p.game.resign <- in
+				ch = game.resign
 			case DRAW_DENY:
 				fallthrough
 			case DRAW_REQUEST:
 				fallthrough
 			case DRAW_ACCEPT:
-				p.game.draw <- in
+				ch = game.draw
 			case ABORT:
-				p.game.abort <- in
+				ch = game.abort
+			case CHAT:
+				fallthrough
+			case CHAT_QUICK:
+				fallthrough
+			case CHAT_MUTE:
+				fallthrough
+			case CHAT_UNMUTE:
+				ch = game.chat
+			case REMATCH_OFFER:
+				fallthrough
+			case REMATCH_ACCEPT:
+				fallthrough
+			case REMATCH_DENY:
+				ch = game.rematch
+			case TAKEBACK_REQUEST:
+				fallthrough
+			case TAKEBACK_ACCEPT:
+				fallthrough
+			case TAKEBACK_DENY:
+				ch = game.takeback
+			case BERSERK:
+				ch = game.berserk
+			}
+			if ch == nil {
+				continue
+			}
+			select {
+			case ch <- in:
+			case <-game.done: // drop messages sent after the game is over
 			}
 		}
 	}
@@ -0,0 +1,335 @@
+package websocket
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"math"
+	"slices"
+	"time"
+)
+
+const ( // variants
+	STANDARD = "standard"
+)
+
+var variants = []string{STANDARD}
+
+var (
+	ratingWindowBase    = 100 // rating difference accepted right away
+	ratingWindowGrowth  = 10  // rating difference added for every second waited
+	ratingWindowMaxWait = 60 * time.Second
+	poolPairingInterval = time.Second // how often waiting seeks are paired with each other
+)
+
+// GameOptions are the settings a game is created with. Players are
+// only paired with games in the same pool, see PoolKey.
+type GameOptions struct {
+	TimeControl TimeControl
+	Variant     string
+	Rated       bool
+}
+
+// category returns the rating category of games with the options
+func (o GameOptions) category() rating.Category {
+	return rating.CategoryOf(o.TimeControl.Estimate())
+}
+
+// Validate returns an error if games with the options cannot be played
+func (o GameOptions) Validate() error {
+	if !slices.Contains(variants, o.Variant) {
+		return fmt.Errorf("unknown variant %q", o.Variant)
+	}
+	return o.TimeControl.Validate()
+}
+
+// PoolKey identifies a matchmaking pool
+type PoolKey struct {
+	Variant     string
+	TimeControl string // TimeControl.String
+	Rated       bool
+}
+
+func (o GameOptions) poolKey() PoolKey {
+	return PoolKey{Variant: o.Variant, TimeControl: o.TimeControl.String(), Rated: o.Rated}
+}
+
+// PoolStatus is the number of players waiting in a pool
+type PoolStatus struct {
+	Variant     string
+	TimeControl string
+	Rated       bool
+	Waiting     int
+}
+
+// seek is a game waiting for a second player
+type seek struct {
+	game      *Game
+	pid       PlayerID  // the waiting player
+	handle    string    // public name of the waiting player
+	rating    int       // rating of the waiting player
+	rated     bool      // whether the game is rated
+	color     string    // color preference of the waiting player
+	minRating int       // lowest rating of an opponent, 0 for any
+	maxRating int       // highest rating of an opponent, 0 for any
+	since     time.Time // when the player started waiting
+}
+
+// newSeek returns the seek of a player requesting a game with options,
+// without a game yet
+func (l *Lobby) newSeek(request *GameRequest, options GameOptions) *seek {
+	handle := l.Handle(request.PlayerID)
+	return &seek{
+		pid:       request.PlayerID,
+		handle:    handle,
+		rating:    int(l.Ratings.Get(handle, options.category()).Rating),
+		rated:     options.Rated,
+		color:     cmp.Or(request.Color, RANDOM),
+		minRating: request.MinRating,
+		maxRating: request.MaxRating,
+		since:     time.Now(),
+	}
+}
+
+// window returns how far apart in rating an opponent can be after
+// waiting for waited. It widens with time and is unlimited after
+// ratingWindowMaxWait, so no player waits forever while others are paired.
+func window(waited time.Duration) int {
+	if waited >= ratingWindowMaxWait {
+		return math.MaxInt
+	}
+	return ratingWindowBase + int(waited/time.Second)*ratingWindowGrowth
+}
+
+// accepts returns true iff a player rated rating can join the seek at
+// now. A seek with a rating range only accepts players in the range,
+// otherwise the accepted difference of a rated seek widens while it
+// waits, see window. A casual seek accepts anyone.
+func (s *seek) accepts(rating int, now time.Time) bool {
+	if s.minRating != 0 || s.maxRating != 0 {
+		return s.inRange(rating)
+	} else if !s.rated {
+		return true
+	}
+	diff := rating - s.rating
+	return max(diff, -diff) <= window(now.Sub(s.since))
+}
+
+// inRange returns true iff rating is in the rating range of the seek
+func (s *seek) inRange(rating int) bool {
+	return (s.minRating == 0 || rating >= s.minRating) && (s.maxRating == 0 || rating <= s.maxRating)
+}
+
+// pool holds the seeks of the same options, oldest first
+type pool struct {
+	timeControl TimeControl
+	seeks       []*seek
+}
+
+func (p *pool) remove(g *Game) {
+	p.seeks = slices.DeleteFunc(p.seeks, func(s *seek) bool { return s.game == g })
+}
+
+// takeFromPool removes and returns the oldest seek that accepts the
+// player of taker, is in their rating range and has a compatible color
+// preference. Games with the same options are searched, or if
+// the lobby has a tolerance, games of the same variant with a similar
+// time control. Seeks are searched in the order they were made, so a
+// player is never skipped for a newer seek they are in range of.
+func (l *Lobby) takeFromPool(options GameOptions, taker *seek) (*seek, bool) {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	now := time.Now()
+	var found *seek
+	var foundPool *pool
+	for key, p := range l.pools {
+		if key.Variant != options.Variant || key.Rated != options.Rated {
+			continue
+		} else if key != options.poolKey() && (l.Tolerance == 0 || !p.timeControl.Similar(options.TimeControl, l.Tolerance)) {
+			continue
+		}
+		for _, s := range p.seeks {
+			if found != nil && !s.since.Before(found.since) {
+				break
+			} else if s.accepts(taker.rating, now) && taker.inRange(s.rating) && compatible(s.color, taker.color) {
+				found, foundPool = s, p
+				break
+			}
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	foundPool.remove(found.game)
+	l.seeksChanged()
+	return found, true
+}
+
+// pairPools pairs the waiting seeks of every pool that accept each other
+// every poolPairingInterval, until the lobby shuts down. Windows widen
+// while players wait, so seeks out of each other's window at first are
+// paired later instead of timing out.
+func (l *Lobby) pairPools() {
+	ticker := time.NewTicker(poolPairingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.pairWaiting(time.Now())
+		case <-l.draining:
+			return
+		}
+	}
+}
+
+// pairWaiting pairs the waiting seeks that accept each other at now. The
+// player of the newer seek moves to the game of the older one.
+func (l *Lobby) pairWaiting(now time.Time) {
+	for _, pair := range l.takePairs(now) {
+		s, taker := pair[0], pair[1]
+		h := handoff{next: s.game, color: l.takerColor(s, taker), pref: taker.color, moved: make(chan bool, 1)}
+		select {
+		case taker.game.handoff <- h:
+			if <-h.moved {
+				continue
+			}
+		case <-taker.game.done:
+		}
+		for _, s := range pair { // still waiting if their game runs
+			select {
+			case <-s.game.done:
+			default:
+				l.addToPool(s)
+			}
+		}
+	}
+}
+
+// takePairs removes and returns the seeks of each pool, older first,
+// whose rating windows and colors accept each other at now
+func (l *Lobby) takePairs(now time.Time) [][2]*seek {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	pairs := [][2]*seek{}
+	for key, p := range l.pools {
+		taken := make(map[*seek]bool)
+		for i, a := range p.seeks {
+			for _, b := range p.seeks[i+1:] {
+				if taken[a] {
+					break
+				} else if !taken[b] && a.accepts(b.rating, now) && b.accepts(a.rating, now) && compatible(a.color, b.color) {
+					taken[a], taken[b] = true, true
+					pairs = append(pairs, [2]*seek{a, b})
+				}
+			}
+		}
+		p.seeks = slices.DeleteFunc(p.seeks, func(s *seek) bool { return taken[s] })
+		if len(p.seeks) == 0 {
+			delete(l.pools, key)
+		}
+	}
+	if len(pairs) > 0 {
+		l.seeksChanged()
+	}
+	return pairs
+}
+
+// handoff asks a waiting game to move its player to next, in the seat
+// color with the color preference pref, see seatPlayerID
+type handoff struct {
+	next  *Game
+	color int
+	pref  string
+	moved chan bool // receives whether the player moved
+}
+
+// handOff seats the waiting player of g in the game of h and moves their
+// connection there. g is over if they moved. Only the game loop may
+// call it.
+func (g *Game) handOff(h handoff) bool {
+	index := whiteIndex
+	if g.playerIDs[whiteIndex] == "" {
+		index = blackIndex
+	}
+	pid := g.playerIDs[index]
+	if g.state != waiting || pid == "" || g.playerIDs[(index+1)%2] != "" {
+		return false
+	} else if _, ok := h.next.takeSeat(pid, h.color, h.pref); !ok {
+		return false
+	}
+
+	g.lobby.mu.Lock()
+	g.lobby.players[pid] = h.next
+	g.lobby.mu.Unlock()
+	g.playerIDs[index] = "" // so clean leaves pid in the lobby
+	if player := g.players[index]; player != nil {
+		g.players[index] = nil
+		player.game.Store(h.next)
+		h.next.join <- player
+	}
+	return true
+}
+
+// addToPool makes the game of s available to players matching its
+// options. Returns false if the pool is full.
+func (l *Lobby) addToPool(s *seek) bool {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	key := s.game.options.poolKey()
+	p, ok := l.pools[key]
+	if !ok {
+		p = &pool{timeControl: s.game.options.TimeControl}
+		l.pools[key] = p
+	}
+	if len(p.seeks) >= gameLimit {
+		return false
+	}
+	p.seeks = append(p.seeks, s)
+	l.seeksChanged()
+	return true
+}
+
+// removeFromPool removes g from its pool if it is still waiting there
+func (l *Lobby) removeFromPool(g *Game) {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	key := g.options.poolKey()
+	if p, ok := l.pools[key]; ok {
+		count := len(p.seeks)
+		p.remove(g)
+		if len(p.seeks) != count {
+			l.seeksChanged()
+		}
+		if len(p.seeks) == 0 {
+			delete(l.pools, key)
+		}
+	}
+}
+
+// Pools returns the number of players waiting in each pool that has any
+func (l *Lobby) Pools() []PoolStatus {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	pools := []PoolStatus{}
+	for key, p := range l.pools {
+		if len(p.seeks) > 0 {
+			pools = append(pools, PoolStatus{Variant: key.Variant, TimeControl: key.TimeControl, Rated: key.Rated, Waiting: len(p.seeks)})
+		}
+	}
+	slices.SortFunc(pools, func(a, b PoolStatus) int {
+		if c := cmp.Or(cmp.Compare(a.Variant, b.Variant), cmp.Compare(a.TimeControl, b.TimeControl)); c != 0 {
+			return c
+		} else if a.Rated == b.Rated {
+			return 0
+		} else if a.Rated {
+			return 1
+		}
+		return -1
+	})
+	return pools
+}
@@ -0,0 +1,55 @@
+package websocket
+
+var (
+	premoveLimit = 1 // number of premoves a player can queue
+)
+
+func (g *Game) premoveOut(action string, index int) *Outbound {
+	out := g.out(action, g.playerIDs[index])
+	out.Moves = g.premoves[index]
+	return out
+}
+
+// queuePremove stores a move sent by the player at index while it is
+// not their turn. Only the player is told about their premoves. When
+// the queue is full the last premove is replaced.
+func (g *Game) queuePremove(p *Player, index int, move string) {
+	if premoveLimit <= 0 {
+		return
+	}
+	if len(g.premoves[index]) >= premoveLimit {
+		g.premoves[index] = g.premoves[index][:premoveLimit-1]
+	}
+	g.premoves[index] = append(g.premoves[index], move)
+	g.deliver(p, g.premoveOut(PREMOVE, index))
+}
+
+// playPremoves plays the queued premoves of the player to move until a
+// player has no premove left. A premove is played at the moment the
+// player's turn started, so it spends none of their time.
+// An illegal premove discards that player's queue.
+// Returns true if a premove ended the game.
+func (g *Game) playPremoves() bool {
+	for {
+		index := g.currentPlayerIndex()
+		if len(g.premoves[index]) == 0 {
+			return false
+		}
+
+		move := g.premoves[index][0]
+		g.premoves[index] = g.premoves[index][1:]
+		valid, over := g.playMove(index, move, g.clock.TurnStart())
+		if over {
+			return true
+		} else if !valid {
+			g.premoves[index] = nil
+			if p := g.players[index]; p != nil {
+				out := g.premoveOut(PREMOVE_FAIL, index)
+				out.Move = move
+				out.Message = "illegal premove"
+				g.deliver(p, out)
+			}
+			return false
+		}
+	}
+}
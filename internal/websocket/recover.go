@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/JDRadatti/reptile/internal/store"
+	"log"
+	"time"
+)
+
+var (
+	journalClockTicks = 10 // ticks of the game loop between journaled clocks
+)
+
+// journal appends entry for the game to the lobby's journal. Only games
+// that started are journaled, waiting games are not worth recovering.
+func (g *Game) journal(entry store.Entry) {
+	if g.lobby.Journal == nil || !g.journaled {
+		return
+	}
+	entry.Game = string(g.id)
+	entry.Time = time.Now().UTC()
+	if err := g.lobby.Journal.Append(entry); err != nil {
+		log.Printf("error journaling game %s: %v", g.id, err)
+	}
+}
+
+// journalStart journals the start of the game with everything needed to
+// rebuild it
+func (g *Game) journalStart() {
+	options, err := json.Marshal(g.options)
+	if err != nil {
+		log.Printf("error journaling game %s: %v", g.id, err)
+		return
+	}
+	g.journaled = true
+	g.journal(store.Entry{
+		Kind:    store.START,
+		Options: options,
+		Players: []string{string(g.playerIDs[whiteIndex]), string(g.playerIDs[blackIndex])},
+		Clocks:  g.journalClocks(g.started),
+
+		Tournament: g.tournament,
+	})
+}
+
+// journalClocks returns the milliseconds left of white and black at now
+func (g *Game) journalClocks(now time.Time) []int {
+	times := g.clockTimes(now)
+	return times[:]
+}
+
+// recover rebuilds the unfinished games of the lobby's journal and
+// restarts them. The clocks stay paused until both players reconnect, so
+// no one loses time while the server was down. Games of a tournament
+// are ended instead, their tournament did not survive the restart.
+func (l *Lobby) recover() {
+	if l.Journal == nil {
+		return
+	}
+	for _, entries := range l.Journal.Unfinished() {
+		if tournament := entries[0].Tournament; tournament != "" {
+			log.Printf("not recovering game %s of tournament %s", entries[0].Game, tournament)
+			l.Journal.Append(store.Entry{Game: entries[0].Game, Kind: store.END, Time: time.Now().UTC()})
+			continue
+		}
+		game, err := l.rebuild(entries)
+		if err != nil {
+			log.Printf("error recovering game %s: %v", entries[0].Game, err)
+			l.Journal.Append(store.Entry{Game: entries[0].Game, Kind: store.END, Time: time.Now().UTC()})
+			continue
+		}
+		for _, pid := range game.playerIDs {
+			l.Join(pid, game)
+		}
+		log.Printf("recovered game %s after %d moves", game.id, game.board.Plies())
+		l.run(game)
+	}
+}
+
+// rebuild replays the journal entries of a game, the first of which
+// starts it
+func (l *Lobby) rebuild(entries []store.Entry) (*Game, error) {
+	start := entries[0]
+	options := GameOptions{}
+	if err := json.Unmarshal(start.Options, &options); err != nil {
+		return nil, err
+	} else if len(start.Players) != 2 || len(start.Clocks) != 2 {
+		return nil, fmt.Errorf("invalid start entry")
+	}
+
+	g := newGame(l, options, GameID(start.Game))
+	g.playerIDs = [2]PlayerID{PlayerID(start.Players[whiteIndex]), PlayerID(start.Players[blackIndex])}
+	g.started = start.Time
+	g.journaled = true
+	g.recovered = true
+
+	clocks := start.Clocks
+	g.times = [][2]int{{clocks[whiteIndex], clocks[blackIndex]}}
+	for _, entry := range entries[1:] {
+		switch entry.Kind {
+		case store.MOVE:
+			if _, ok := g.board.Move(entry.Move); !ok || len(entry.Clocks) != 2 {
+				return nil, fmt.Errorf("invalid move %q", entry.Move)
+			}
+			g.times = append(g.times, [2]int{entry.Clocks[whiteIndex], entry.Clocks[blackIndex]})
+		case store.TAKEBACK:
+			for g.board.Plies() > entry.Plies {
+				if !g.board.Undo() {
+					return nil, fmt.Errorf("invalid takeback to %d plies", entry.Plies)
+				}
+			}
+			g.times = g.times[:g.board.Plies()+1]
+		case store.BERSERK:
+			if len(entry.Berserk) != 2 || len(entry.Clocks) != 2 {
+				return nil, fmt.Errorf("invalid berserk entry")
+			}
+			g.berserked = [2]bool{entry.Berserk[whiteIndex], entry.Berserk[blackIndex]}
+			g.times[len(g.times)-1] = [2]int{entry.Clocks[whiteIndex], entry.Clocks[blackIndex]}
+		}
+		if len(entry.Clocks) == 2 {
+			clocks = entry.Clocks
+		}
+	}
+
+	plies := g.board.Plies()
+	g.clock.Restore(
+		[2]time.Duration{time.Duration(clocks[whiteIndex]) * time.Millisecond, time.Duration(clocks[blackIndex]) * time.Millisecond},
+		[2]int{(plies + 1) / 2, plies / 2},
+	)
+	g.clock.berserk = g.berserked
+	return g, nil
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"github.com/JDRadatti/reptile/internal/chess"
+	"time"
+)
+
+var (
+	rematchWait = 30 * time.Second // how long players can offer a rematch after a game ends
+)
+
+// postGame keeps the game alive for rematchWait after a finished game
+// so players can chat and offer or accept a rematch. Games that were
+// killed or aborted have no rematch window.
+func (g *Game) postGame() {
+	defer g.closeAll()
+	if g.result == "" {
+		return
+	}
+
+	timer := time.NewTimer(rematchWait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return
+		case <-g.lobby.draining:
+			return
+		case player := <-g.join:
+			g.deliver(player, handshakeFail())
+			g.drop(player) // lobby no longer knows this game
+		case player := <-g.leave:
+			g.drop(player)
+			if g.players[whiteIndex] == nil && g.players[blackIndex] == nil {
+				return
+			}
+		case chatRequest := <-g.chat:
+			g.handleChat(chatRequest)
+		case rematchRequest := <-g.rematch:
+			index, ok := g.playerIndex(rematchRequest.PlayerID)
+			if !ok || g.onEnd != nil { // games of a Pairing have no rematch
+				continue
+			}
+			if g.pendingRematch == -1 && rematchRequest.Action == REMATCH_OFFER {
+				out := g.out(REMATCH_OFFER, g.playerIDs[index])
+				g.sendToOpponent(out, index)
+				g.pendingRematch = index
+			} else if g.pendingRematch == (index+1)%2 && rematchRequest.Action == REMATCH_ACCEPT {
+				g.startRematch()
+				return
+			} else if g.pendingRematch == (index+1)%2 && rematchRequest.Action == REMATCH_DENY {
+				out := g.out(REMATCH_DENY, g.playerIDs[index])
+				out.Player = chess.Player(index)
+				g.sendBoth(out)
+				return
+			}
+		case <-g.move: // game actions are ignored once the game is over
+		case <-g.resign:
+		case <-g.draw:
+		case <-g.abort:
+		case <-g.takeback:
+		case <-g.berserk:
+		}
+	}
+}
+
+// startRematch creates a new game with the same time control and
+// swapped colors and moves every connected player into it
+func (g *Game) startRematch() {
+	white, black := g.playerIDs[blackIndex], g.playerIDs[whiteIndex]
+	if g.lobby.Draining() {
+		out := g.out(REMATCH_FAIL, "")
+		out.Message = "the server is restarting"
+		g.sendBoth(out)
+		return
+	}
+	next := newGame(g.lobby, g.options, generateGameID())
+	next.addPlayerID(white)
+	next.addPlayerID(black)
+	if busy, ok := g.lobby.joinBoth(white, black, next); !ok {
+		out := g.out(REMATCH_FAIL, busy)
+		out.Message = "player already in another game"
+		g.sendBoth(out)
+		return
+	}
+	outs := make(map[PlayerID]*Outbound)
+	for _, pid := range []PlayerID{white, black} {
+		outs[pid] = next.out(REMATCH, pid)
+		outs[pid].Player = next.playerType(pid)
+	}
+	spectatorOut := next.out(REMATCH, "")
+	spectatorOut.Player = chess.INVALID_PLAYER
+	if !g.lobby.run(next) { // next belongs to its game loop from here on
+		out := g.out(REMATCH_FAIL, "")
+		out.Message = "the server is restarting"
+		g.sendBoth(out)
+		return
+	}
+
+	for i, player := range g.players {
+		if player == nil {
+			continue
+		}
+		g.deliver(player, outs[player.id])
+
+		g.players[i] = nil
+		player.game.Store(next)
+		next.join <- player
+	}
+
+	for _, s := range g.spectators {
+		g.deliver(s.player, spectatorOut)
+	}
+}
+
+// closeAll disconnects everyone still connected to the game
+func (g *Game) closeAll() {
+	for _, player := range g.players {
+		if player != nil {
+			g.drop(player)
+		}
+	}
+	for _, s := range g.spectators {
+		g.drop(s.player)
+	}
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRematch(t *testing.T) {
+	l := NewLobby()
+	white, black := GeneratePlayerID(), GeneratePlayerID()
+	response := l.Match(&GameRequest{PlayerID: white, Time: 60, Color: WHITE})
+	assert.Equal(t, response.GameID, l.Match(&GameRequest{PlayerID: black, Time: 60}).GameID)
+
+	whiteConn := connect(t, l, response.GameID, white)
+	blackConn := connect(t, l, response.GameID, black)
+	receiveAction(t, whiteConn, GAME_START)
+	receiveAction(t, blackConn, GAME_START)
+
+	sendMessage(t, whiteConn, &Inbound{Action: RESIGN, PlayerID: white})
+	receiveAction(t, whiteConn, RESIGN)
+	receiveAction(t, blackConn, RESIGN)
+
+	// only the player offered a rematch can decline it
+	sendMessage(t, whiteConn, &Inbound{Action: REMATCH_DENY, PlayerID: white})
+	sendMessage(t, whiteConn, &Inbound{Action: REMATCH_OFFER, PlayerID: white})
+	sendMessage(t, whiteConn, &Inbound{Action: REMATCH_DENY, PlayerID: white})
+	receiveAction(t, blackConn, REMATCH_OFFER)
+	sendMessage(t, blackConn, &Inbound{Action: REMATCH_ACCEPT, PlayerID: black})
+
+	whiteRematch := receiveAction(t, whiteConn, REMATCH)
+	blackRematch := receiveAction(t, blackConn, REMATCH)
+	assert.Equal(t, chess.BLACK, whiteRematch.Player)
+	assert.Equal(t, chess.WHITE, blackRematch.Player)
+	assert.Equal(t, whiteRematch.GameID, blackRematch.GameID)
+	assert.NotEqual(t, response.GameID, whiteRematch.GameID)
+
+	start := receiveAction(t, whiteConn, GAME_START)
+	assert.Equal(t, whiteRematch.GameID, start.GameID)
+	receiveAction(t, blackConn, GAME_START)
+
+	// colors are swapped so black moves first
+	move := playMove(t, blackConn, black, "e2e4", whiteConn)
+	assert.Equal(t, "e4", move.Move)
+}
@@ -2,19 +2,33 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/JDRadatti/reptile/internal/chess"
 	"log"
 )
 
 const ( // incoming action
-	JOIN         = "join"
-	MOVE         = "move"
-	RESIGN       = "resign"
-	DRAW         = "draw" // both players must send to accept draw
-	DRAW_REQUEST = "draw_request"
-	DRAW_ACCEPT  = "draw_accept"
-	DRAW_DENY    = "draw_deny"
-	ABORT        = "abort"
+	JOIN             = "join"
+	MOVE             = "move"
+	RESIGN           = "resign"
+	DRAW             = "draw" // both players must send to accept draw
+	DRAW_REQUEST     = "draw_request"
+	DRAW_ACCEPT      = "draw_accept"
+	DRAW_DENY        = "draw_deny"
+	ABORT            = "abort"
+	WATCH            = "watch" // join a game as a spectator
+	CHAT             = "chat"
+	CHAT_QUICK       = "chat_quick" // Message is a key of quickMessages
+	CHAT_MUTE        = "chat_mute"
+	CHAT_UNMUTE      = "chat_unmute"
+	REMATCH_OFFER    = "rematch_offer"
+	REMATCH_ACCEPT   = "rematch_accept"
+	REMATCH_DENY     = "rematch_deny"
+	TAKEBACK_REQUEST = "takeback_request"
+	TAKEBACK_ACCEPT  = "takeback_accept"
+	TAKEBACK_DENY    = "takeback_deny"
+	PREMOVE_CANCEL   = "premove_cancel"
+	BERSERK          = "berserk" // halve your clock in a tournament game, also sent to everyone
 )
 
 const ( // outgoing status
@@ -28,41 +42,132 @@ const ( // outgoing status
 	RESIGN_SUCCESS = "resign_success"
 	DRAW_SUCCESS   = "draw_success"
 	TIME_UPDATE    = "time_update"
-	GAME_KILL      = "game_kill"
+	QUEUE_TIMEOUT  = "queue_timeout" // no opponent was found in maxWaitTime
+	CHAT_HISTORY   = "chat_history"
+	CHAT_FAIL      = "chat_fail"
+	REMATCH        = "rematch" // GameID is the id of the new game
+	REMATCH_FAIL   = "rematch_fail"
+	TAKEBACK       = "takeback"     // Moves has the moves left after the takeback
+	PREMOVE        = "premove"      // Moves has the queued premoves
+	PREMOVE_FAIL   = "premove_fail" // Move was illegal and the queue was discarded
+	SHUTDOWN       = "shutdown"     // the server is restarting, see Message
+	SEEKS          = "seeks"        // sent on the seek board, see SeekUpdate
+)
+
+const ( // notification actions, see Notification
+	CHALLENGE         = "challenge"
+	CHALLENGE_ACCEPT  = "challenge_accept" // GameID is the id of the game
+	CHALLENGE_DECLINE = "challenge_decline"
+	CHALLENGE_CANCEL  = "challenge_cancel"
+	CHALLENGE_EXPIRE  = "challenge_expire"
+	TOURNAMENT_GAME   = "tournament_game" // GameID is the id of the next game of a tournament
+)
+
+const ( // color preferences
+	WHITE  = "white"
+	BLACK  = "black"
+	RANDOM = "random"
 )
 
 type Inbound struct {
 	Action   string
 	Move     string
+	Message  string
 	PlayerID PlayerID
 	GameID   GameID
+	Token    string `json:",omitempty"` // session or seat token, the cookie is used if empty
+
+	from *Player // connection the message was read from, see Game.sender
 }
 
 type Outbound struct {
-	Action    string
-	Move      string
-	FEN       string
-	PlayerID  PlayerID
-	GameID    GameID
-	WhiteTime int
-	BlackTime int
-	Increment int
-	Player    chess.Player
-	Turn      chess.Player
+	Action      string
+	Move        string
+	FEN         string
+	PlayerID    PlayerID // only in JOIN_SUCCESS to the player, see Handle
+	Handle      string   `json:",omitempty"` // public name of the player the message is about
+	Token       string   `json:",omitempty"` // seat token of a new anonymous player
+	GameID      GameID
+	WhiteTime   int // milliseconds
+	BlackTime   int // milliseconds
+	Increment   int
+	WhiteLag    int // estimated network lag in milliseconds
+	BlackLag    int
+	Player      chess.Player
+	Turn        chess.Player
+	TimeControl string        `json:",omitempty"`
+	PGN         string        `json:",omitempty"` // sent when the game ends
+	Message     string        `json:",omitempty"`
+	Chat        []ChatMessage `json:",omitempty"`
+	Moves       []string      `json:",omitempty"`
+	RatingDelta []int         `json:",omitempty"` // white and black rating changes of a rated game
 }
 
-// GameRequest is sent from the client when wanting to join a game
+// GameRequest is sent from the client when wanting to join a game.
+// TimeControl is used if set, otherwise Time and Increment in seconds.
+// Variant defaults to STANDARD.
 type GameRequest struct {
-	PlayerID  PlayerID
-	Time      int
-	Increment int
+	PlayerID    PlayerID `json:"-"` // set from the token of the request
+	Token       string   // seat or session token, the cookie is used if empty
+	Time        int
+	Increment   int
+	TimeControl *TimeControl
+	Variant     string
+	Rated       bool
+	Color       string // WHITE, BLACK or RANDOM, RANDOM if empty
+	MinRating   int    // lowest rating of an opponent, 0 for any
+	MaxRating   int    // highest rating of an opponent, 0 for any
+}
+
+// colorIndex returns the seat of the requested color, -1 if the player
+// has no preference
+func (r *GameRequest) colorIndex() int {
+	switch r.Color {
+	case WHITE:
+		return whiteIndex
+	case BLACK:
+		return blackIndex
+	}
+	return -1
+}
+
+// timeControl returns the requested time control, or the default if
+// the request has none
+func (r *GameRequest) timeControl() TimeControl {
+	if r.TimeControl != nil {
+		return *r.TimeControl
+	} else if r.Time == 0 && r.Increment == 0 {
+		return defaultTimeControl
+	}
+	return FischerTimeControl(r.Time, r.Increment)
+}
+
+// Options returns the options of the requested game
+func (r *GameRequest) Options() GameOptions {
+	variant := r.Variant
+	if variant == "" {
+		variant = STANDARD
+	}
+	return GameOptions{TimeControl: r.timeControl(), Variant: variant, Rated: r.Rated}
+}
+
+// Validate returns an error if the requested game cannot be played
+func (r *GameRequest) Validate() error {
+	if r.Color != "" && r.Color != WHITE && r.Color != BLACK && r.Color != RANDOM {
+		return fmt.Errorf("unknown color %q", r.Color)
+	} else if r.MinRating < 0 || r.MaxRating < 0 || (r.MaxRating != 0 && r.MinRating > r.MaxRating) {
+		return fmt.Errorf("invalid rating range %d-%d", r.MinRating, r.MaxRating)
+	}
+	return r.Options().Validate()
 }
 
 // GameResponse is sent from the client after joining a game
 type GameResponse struct {
-	PlayerID PlayerID
+	PlayerID PlayerID // secret, only sent to the player
+	Handle   string   // public name shown to other players
+	Token    string   // seat token to join the game with
 	GameID   GameID
-	Player   chess.Player
+	Player   chess.Player // may change until GAME_START if the player is waiting
 }
 
 func unmarshal(message []byte) (*Inbound, bool) {
@@ -0,0 +1,263 @@
+package websocket
+
+import (
+	"cmp"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// SeekStatus is a game waiting for an opponent as shown on the seek
+// board
+type SeekStatus struct {
+	GameID      GameID
+	Handle      string // public name of the waiting player
+	Rating      int
+	TimeControl string
+	Variant     string
+	Rated       bool
+	Color       string `json:",omitempty"` // color preference of the waiting player
+	MinRating   int    `json:",omitempty"`
+	MaxRating   int    `json:",omitempty"`
+	Since       time.Time
+}
+
+// SeekUpdate is sent on the seek board websocket with every open seek
+// whenever they change
+type SeekUpdate struct {
+	Action string // SEEKS
+	Seeks  []SeekStatus
+}
+
+// seekWatcher is a connection to the seek board
+type seekWatcher struct {
+	send chan []SeekStatus // holds only the latest seeks
+}
+
+// Seeks returns every seek in the pools, oldest first
+func (l *Lobby) Seeks() []SeekStatus {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	seeks := []SeekStatus{}
+	for _, p := range l.pools {
+		for _, s := range p.seeks {
+			seeks = append(seeks, SeekStatus{
+				GameID:      s.game.id,
+				Handle:      s.handle,
+				Rating:      s.rating,
+				TimeControl: s.game.options.TimeControl.String(),
+				Variant:     s.game.options.Variant,
+				Rated:       s.game.options.Rated,
+				Color:       s.color,
+				MinRating:   s.minRating,
+				MaxRating:   s.maxRating,
+				Since:       s.since,
+			})
+		}
+	}
+	slices.SortFunc(seeks, func(a, b SeekStatus) int {
+		return cmp.Or(a.Since.Compare(b.Since), cmp.Compare(a.GameID, b.GameID))
+	})
+	return seeks
+}
+
+// Seek posts a seek on the seek board. Unlike Match it never pairs the
+// player right away, the game starts when someone accepts the seek.
+func (l *Lobby) Seek(request *GameRequest) *GameResponse {
+	return l.host(request, true)
+}
+
+// Challenge creates a private game only joined by its link. The game is
+// never in a pool, so it is not on the seek board or paired by Match.
+func (l *Lobby) Challenge(request *GameRequest) *GameResponse {
+	return l.host(request, false)
+}
+
+// host creates a game for the player of request and adds it to the
+// pools if public
+func (l *Lobby) host(request *GameRequest, public bool) *GameResponse {
+	if l.Draining() {
+		return l.Fail()
+	}
+	options := request.Options()
+	s := l.newSeek(request, options)
+
+	l.mu.Lock()
+	if _, ok := l.players[request.PlayerID]; ok {
+		l.mu.Unlock()
+		return l.Fail()
+	}
+	s.game = NewGame(l, options)
+	if public && !l.addToPool(s) {
+		log.Printf("game pool full, game %s can only be joined by link", s.game.id)
+	}
+	l.join(request.PlayerID, s.game)
+	l.mu.Unlock()
+
+	return l.seat(request.PlayerID, s.game, request.colorIndex(), s.color)
+}
+
+// Accept joins the game of the seek gid if the player of request is in
+// its rating range
+func (l *Lobby) Accept(request *GameRequest, gid GameID) *GameResponse {
+	if l.Draining() {
+		return l.Fail()
+	}
+
+	l.mu.Lock()
+	if _, ok := l.players[request.PlayerID]; ok {
+		l.mu.Unlock()
+		return l.Fail()
+	}
+	taker := l.newSeek(request, request.Options())
+	s, ok := l.takeSeek(taker, gid)
+	if !ok {
+		l.mu.Unlock()
+		return l.Fail()
+	}
+	l.join(request.PlayerID, s.game)
+	l.mu.Unlock()
+
+	return l.seat(request.PlayerID, s.game, l.takerColor(s, taker), taker.color)
+}
+
+// takeSeek removes and returns the seek gid if it accepts the player of
+// taker and has a compatible color preference. The options of taker are
+// not used.
+func (l *Lobby) takeSeek(taker *seek, gid GameID) (*seek, bool) {
+	l.poolMu.Lock()
+	defer l.poolMu.Unlock()
+
+	for _, p := range l.pools {
+		for _, s := range p.seeks {
+			if s.game.id != gid {
+				continue
+			}
+			rating := int(l.Ratings.Get(taker.handle, s.game.options.category()).Rating)
+			if s.handle == taker.handle || !s.inRange(rating) || !compatible(s.color, taker.color) {
+				return nil, false
+			}
+			p.remove(s.game)
+			l.seeksChanged()
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// seeksChanged tells the seek board the seeks changed, without blocking
+func (l *Lobby) seeksChanged() {
+	select {
+	case l.seekUpdates <- struct{}{}:
+	default:
+	}
+}
+
+// broadcastSeeks sends the seeks to every seek board connection when
+// they change, until the lobby shuts down
+func (l *Lobby) broadcastSeeks() {
+	for {
+		select {
+		case <-l.seekUpdates:
+		case <-l.draining:
+			return
+		}
+		seeks := l.Seeks()
+		l.watchMu.Lock()
+		for w := range l.watchers {
+			w.update(seeks)
+		}
+		l.watchMu.Unlock()
+	}
+}
+
+// update replaces the seeks waiting to be sent to w, it never blocks
+func (w *seekWatcher) update(seeks []SeekStatus) {
+	select {
+	case <-w.send:
+	default:
+	}
+	w.send <- seeks
+}
+
+func (l *Lobby) watchSeeks() *seekWatcher {
+	w := &seekWatcher{send: make(chan []SeekStatus, 1)}
+	l.watchMu.Lock()
+	l.watchers[w] = struct{}{}
+	w.update(l.Seeks())
+	l.watchMu.Unlock()
+	return w
+}
+
+func (l *Lobby) unwatchSeeks(w *seekWatcher) {
+	l.watchMu.Lock()
+	delete(l.watchers, w)
+	l.watchMu.Unlock()
+}
+
+// SeeksHandler serves the seek board websocket. Seeks are posted and
+// accepted over HTTP, the websocket only sends SeekUpdates.
+type SeeksHandler struct {
+	Lobby *Lobby
+}
+
+func (h *SeeksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	watcher := h.Lobby.watchSeeks()
+	defer h.Lobby.unwatchSeeks(watcher)
+
+	// read only to notice the connection closing and answer pings
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(maxMessageSize)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pongWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case seeks := <-watcher.send:
+			message, err := json.Marshal(SeekUpdate{Action: SEEKS, Seeks: seeks})
+			if err != nil {
+				log.Printf("error: %v", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-h.Lobby.draining:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+			return
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/JDRadatti/reptile/internal/chess"
+	"github.com/JDRadatti/reptile/internal/rating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekBoard(t *testing.T) {
+	l := NewLobby()
+	poster := rated(l, 0)
+	posted := l.Seek(&GameRequest{PlayerID: poster, Time: 300, Color: BLACK, MinRating: 1600})
+	assert.Equal(t, chess.BLACK, posted.Player)
+	seeks := l.Seeks()
+	assert.Len(t, seeks, 1)
+	assert.Equal(t, SeekStatus{
+		GameID:      posted.GameID,
+		Handle:      l.Handle(poster),
+		Rating:      1500,
+		TimeControl: "300",
+		Variant:     STANDARD,
+		Color:       BLACK,
+		MinRating:   1600,
+		Since:       seeks[0].Since,
+	}, seeks[0])
+
+	// players out of the rating range are not paired with the seek
+	matched := l.Match(&GameRequest{PlayerID: rated(l, 0), Time: 300})
+	assert.NotEqual(t, posted.GameID, matched.GameID)
+	assert.Len(t, l.Seeks(), 2)
+	assert.Equal(t, GameID(""), l.Accept(&GameRequest{PlayerID: rated(l, 0)}, posted.GameID).GameID)
+	assert.Equal(t, GameID(""), l.Accept(&GameRequest{PlayerID: poster}, posted.GameID).GameID)
+
+	strong := rated(l, 1)
+	assert.Greater(t, l.Ratings.Get(l.Handle(strong), rating.BLITZ).Rating, 1600.0)
+	accepted := l.Accept(&GameRequest{PlayerID: strong}, posted.GameID)
+	assert.Equal(t, posted.GameID, accepted.GameID)
+	assert.Equal(t, chess.WHITE, accepted.Player)
+	assert.Len(t, l.Seeks(), 1)
+	assert.Equal(t, matched.GameID, l.Seeks()[0].GameID)
+
+	// challenges are only joined by link
+	challenge := l.Challenge(&GameRequest{PlayerID: rated(l, 0), Time: 300, Color: WHITE})
+	assert.Equal(t, chess.WHITE, challenge.Player)
+	assert.Len(t, l.Seeks(), 1)
+	assert.Equal(t, matched.GameID, l.Match(&GameRequest{PlayerID: rated(l, 0), Time: 300}).GameID)
+	assert.Equal(t, GameID(""), l.Accept(&GameRequest{PlayerID: rated(l, 0)}, challenge.GameID).GameID)
+	friend := GeneratePlayerID()
+	connect(t, l, challenge.GameID, friend)
+	game, _ := l.GetGameFromPlayerID(friend)
+	assert.Equal(t, challenge.GameID, game.id)
+}
+
+func TestSeeksHandler(t *testing.T) {
+	l := NewLobby()
+	s, conn := newWSServer(t, &SeeksHandler{Lobby: l})
+	defer s.Close()
+	defer conn.Close()
+	receive := func() SeekUpdate {
+		_, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		update := SeekUpdate{}
+		assert.NoError(t, json.Unmarshal(message, &update))
+		assert.Equal(t, SEEKS, update.Action)
+		return update
+	}
+
+	assert.Empty(t, receive().Seeks)
+	posted := l.Seek(&GameRequest{PlayerID: GeneratePlayerID(), Time: 60})
+	update := receive()
+	assert.Len(t, update.Seeks, 1)
+	assert.Equal(t, posted.GameID, update.Seeks[0].GameID)
+
+	l.Accept(&GameRequest{PlayerID: GeneratePlayerID()}, posted.GameID)
+	assert.Empty(t, receive().Seeks)
+}
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"log"
+)
+
+var (
+	sendBuffer = 32 // messages queued for a connection before it is dropped as too slow
+)
+
+// deliver queues out for p without blocking the game loop. Time updates
+// are coalesced so p only gets the latest one. A connection whose queue
+// is full can not keep up and is disconnected, the player can reconnect.
+func (g *Game) deliver(p *Player, out *Outbound) {
+	if p.closed {
+		return
+	}
+	if out.Action == TIME_UPDATE {
+		p.pendingTime.Store(out)
+		select {
+		case p.timeReady <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	p.pendingTime.Store(nil) // out has newer times
+	select {
+	case p.send <- out:
+	default:
+		log.Printf("connection of %s in game %s is too slow, disconnecting", g.handle(p.id), g.id)
+		g.disconnect(p)
+	}
+}
+
+// disconnect removes p from the game and closes its connection, which
+// also stops a write that is stuck
+func (g *Game) disconnect(p *Player) {
+	g.drop(p)
+	p.conn.Close()
+}
+
+// drop removes p from the game if it still is in it and closes its
+// queue, so its write goroutine stops once the queue is written.
+// Messages p read before it was dropped are rejected by sender.
+func (g *Game) drop(p *Player) {
+	if index, ok := g.playerIndex(p.id); ok && g.players[index] == p {
+		g.players[index] = nil
+	} else if s, ok := g.spectators[p.id]; ok && s.player == p {
+		delete(g.spectators, p.id)
+	}
+	if !p.closed {
+		p.closed = true
+		close(p.send)
+	}
+}
+
+// sender returns the seat of the player that sent in, if the connection
+// it was read from is still seated. Messages of a dropped or replaced
+// connection can still be queued and are rejected.
+func (g *Game) sender(in *Inbound) (*Player, int, bool) {
+	player, index, ok := g.playerFromID(in.PlayerID)
+	if !ok || player == nil || player != in.from {
+		return nil, -1, false
+	}
+	return player, index, true
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+// run starts the game loop of g, Shutdown waits for it to return.
+// Once the lobby is draining g is not started, it is closed and
+// forgotten instead. Returns whether g runs.
+func (l *Lobby) run(g *Game) bool {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.Draining() {
+		close(g.done)
+		go l.discard(g) // callers may hold mu
+		return false
+	}
+	l.running.Add(1)
+	go g.play()
+	return true
+}
+
+// discard removes a game that never ran from the lobby
+func (l *Lobby) discard(g *Game) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.games, g.id)
+	for pid, game := range l.players {
+		if game == g {
+			delete(l.players, pid)
+		}
+	}
+	l.removeFromPool(g)
+}
+
+// Draining returns whether the lobby is shutting down and no longer
+// accepts new games
+func (l *Lobby) Draining() bool {
+	select {
+	case <-l.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// ShuttingDown returns a channel that is closed when Shutdown is called
+func (l *Lobby) ShuttingDown() <-chan struct{} {
+	return l.draining
+}
+
+// Shutdown stops accepting new games, tells every connected player the
+// server is shutting down and waits for running games to finish. Games
+// still running when ctx is done are stopped, they are left unfinished
+// in the journal to be recovered after the restart. Returns ctx.Err()
+// if games had to be stopped.
+func (l *Lobby) Shutdown(ctx context.Context) error {
+	l.shutdownOnce.Do(func() {
+		l.shutdownMessage = "the server is restarting"
+		if deadline, ok := ctx.Deadline(); ok {
+			l.shutdownMessage += fmt.Sprintf(", games have %d seconds to finish", int(time.Until(deadline).Seconds()))
+		}
+		if l.Journal != nil {
+			l.shutdownMessage += " or will continue after the restart"
+		}
+		l.runMu.Lock()
+		close(l.draining)
+		l.runMu.Unlock()
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		l.stopOnce.Do(func() { close(l.stopping) })
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// closeMessage returns the close frame sent when the game closes the
+// connection of p
+func (p *Player) closeMessage() []byte {
+	if !p.lobby.Draining() {
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	} else if p.lobby.Journal != nil {
+		return websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+	}
+	return websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+}
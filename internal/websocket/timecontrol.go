@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const ( // time control modes
+	FISCHER   = "fischer"   // increment added after every move
+	DELAY     = "delay"     // simple (US) delay, the clock only runs once the delay is over
+	BRONSTEIN = "bronstein" // time used is given back after the move, up to the delay
+	HOURGLASS = "hourglass" // time used by a player is added to the opponent
+)
+
+const (
+	maxStages      = 4
+	estimatedMoves = 40
+)
+
+var (
+	minTime       = 15          // seconds on the clock at the start of the game
+	maxTime       = 3 * 60 * 60 // seconds added by any stage
+	maxIncrement  = 180         // seconds of increment or delay
+	maxStageMoves = 100
+)
+
+var defaultTimeControl = FischerTimeControl(defaultTime, defaultIncrement)
+
+var defaultGameOptions = GameOptions{TimeControl: defaultTimeControl, Variant: STANDARD}
+
+// Stage is one period of a time control. Time is added to a player's
+// clock when they reach the stage and Increment is the increment or
+// delay, depending on the mode, of every move in the stage.
+type Stage struct {
+	Moves     int // moves in the stage, 0 for the rest of the game
+	Time      int // seconds
+	Increment int // seconds
+}
+
+// TimeControl describes the clocks of a game. Multi-stage controls like
+// 40 moves in 90 minutes then 30 minutes with 30 seconds increment are
+// {FISCHER, [{40, 5400, 0}, {0, 1800, 30}]}.
+type TimeControl struct {
+	Mode   string
+	Stages []Stage
+}
+
+// FischerTimeControl returns a single stage control with an increment
+func FischerTimeControl(time int, increment int) TimeControl {
+	return TimeControl{
+		Mode:   FISCHER,
+		Stages: []Stage{{Time: time, Increment: increment}},
+	}
+}
+
+// Validate returns an error if the time control cannot be played: times
+// and increments are out of bounds, a stage but the last has no number
+// of moves or an hourglass has more than one stage or an increment.
+func (tc TimeControl) Validate() error {
+	switch tc.Mode {
+	case FISCHER, DELAY, BRONSTEIN, HOURGLASS:
+	default:
+		return fmt.Errorf("unknown time control mode %q", tc.Mode)
+	}
+	if len(tc.Stages) == 0 || len(tc.Stages) > maxStages {
+		return fmt.Errorf("time control must have between 1 and %d stages", maxStages)
+	} else if tc.Stages[0].Time < minTime {
+		return fmt.Errorf("time must be at least %d seconds", minTime)
+	}
+	for i, stage := range tc.Stages {
+		last := i == len(tc.Stages)-1
+		if stage.Time < 0 || stage.Time > maxTime {
+			return fmt.Errorf("time must be at most %d seconds", maxTime)
+		} else if stage.Increment < 0 || stage.Increment > maxIncrement {
+			return fmt.Errorf("increment must be between 0 and %d seconds", maxIncrement)
+		} else if last && stage.Moves != 0 {
+			return errors.New("the last stage must last the rest of the game")
+		} else if !last && (stage.Moves <= 0 || stage.Moves > maxStageMoves) {
+			return fmt.Errorf("stages must last between 1 and %d moves", maxStageMoves)
+		}
+	}
+	if tc.Mode == HOURGLASS && (len(tc.Stages) != 1 || tc.Stages[0].Increment != 0) {
+		return errors.New("hourglass must have one stage without increment")
+	}
+	return nil
+}
+
+// Similar returns true iff both time controls have the same mode and
+// stage moves, and the time and increment of every stage are within
+// tolerance, a fraction of the larger of the two.
+func (tc TimeControl) Similar(other TimeControl, tolerance float64) bool {
+	if tc.Mode != other.Mode || len(tc.Stages) != len(other.Stages) {
+		return false
+	}
+	within := func(a, b int) bool {
+		return math.Abs(float64(a-b)) <= tolerance*float64(max(a, b))
+	}
+	for i, stage := range tc.Stages {
+		o := other.Stages[i]
+		if stage.Moves != o.Moves || !within(stage.Time, o.Time) || !within(stage.Increment, o.Increment) {
+			return false
+		}
+	}
+	return true
+}
+
+// Estimate returns the estimated seconds a player uses in a game of 40
+// moves, the base time plus the increments and stages of 40 moves
+func (tc TimeControl) Estimate() int {
+	seconds := tc.Stages[0].Time
+	for moves := range estimatedMoves {
+		stage := tc.stage(moves)
+		seconds += tc.Stages[stage].Increment
+		if next := tc.stage(moves + 1); next != stage {
+			seconds += tc.Stages[next].Time
+		}
+	}
+	return seconds
+}
+
+// stage returns the stage a player is in after making moves moves
+func (tc TimeControl) stage(moves int) int {
+	for i, stage := range tc.Stages {
+		if stage.Moves == 0 || moves < stage.Moves {
+			return i
+		}
+		moves -= stage.Moves
+	}
+	return len(tc.Stages) - 1
+}
+
+// separator returns the character between the time and increment of a
+// stage in the PGN tag
+func (tc TimeControl) separator() string {
+	switch tc.Mode {
+	case DELAY:
+		return "d"
+	case BRONSTEIN:
+		return "b"
+	}
+	return "+"
+}
+
+// String returns the time control in the format of the PGN TimeControl
+// tag, for example "300+2" or "40/5400:1800+30". Hourglass controls
+// are written as "*300". Delays are not part of the PGN standard and
+// are written as "300d5" for simple delay and "300b5" for Bronstein.
+func (tc TimeControl) String() string {
+	if tc.Mode == HOURGLASS && len(tc.Stages) > 0 {
+		return "*" + strconv.Itoa(tc.Stages[0].Time)
+	}
+	fields := make([]string, len(tc.Stages))
+	for i, stage := range tc.Stages {
+		field := strconv.Itoa(stage.Time)
+		if stage.Moves > 0 {
+			field = fmt.Sprintf("%d/%s", stage.Moves, field)
+		}
+		if stage.Increment > 0 {
+			field += tc.separator() + strconv.Itoa(stage.Increment)
+		}
+		fields[i] = field
+	}
+	return strings.Join(fields, ":")
+}
+
+// ParseTimeControl parses a time control written by TimeControl.String
+func ParseTimeControl(s string) (TimeControl, error) {
+	invalid := fmt.Errorf("invalid time control %q", s)
+	tc := TimeControl{Mode: FISCHER}
+	if rest, found := strings.CutPrefix(s, "*"); found {
+		tc.Mode = HOURGLASS
+		s = rest
+	}
+
+	for _, field := range strings.Split(s, ":") {
+		var err error
+		stage := Stage{}
+		if moves, rest, found := strings.Cut(field, "/"); found {
+			if stage.Moves, err = strconv.Atoi(moves); err != nil {
+				return TimeControl{}, invalid
+			}
+			field = rest
+		}
+		if i := strings.IndexAny(field, "+db"); i != -1 {
+			switch {
+			case tc.Mode == HOURGLASS: // hourglass has no increment, Validate fails
+			case field[i] == 'd':
+				tc.Mode = DELAY
+			case field[i] == 'b':
+				tc.Mode = BRONSTEIN
+			}
+			if stage.Increment, err = strconv.Atoi(field[i+1:]); err != nil {
+				return TimeControl{}, invalid
+			}
+			field = field[:i]
+		}
+		if stage.Time, err = strconv.Atoi(field); err != nil {
+			return TimeControl{}, invalid
+		}
+		tc.Stages = append(tc.Stages, stage)
+	}
+
+	if tc.Validate() != nil {
+		return TimeControl{}, invalid
+	}
+	return tc, nil
+}
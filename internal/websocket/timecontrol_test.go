@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeControlString(t *testing.T) {
+	inputs := []struct {
+		tag string
+		tc  TimeControl
+	}{
+		{"300", TimeControl{Mode: FISCHER, Stages: []Stage{{Time: 300}}}},
+		{"180+2", TimeControl{Mode: FISCHER, Stages: []Stage{{Time: 180, Increment: 2}}}},
+		{"300d5", TimeControl{Mode: DELAY, Stages: []Stage{{Time: 300, Increment: 5}}}},
+		{"300b5", TimeControl{Mode: BRONSTEIN, Stages: []Stage{{Time: 300, Increment: 5}}}},
+		{"*60", TimeControl{Mode: HOURGLASS, Stages: []Stage{{Time: 60}}}},
+		{"40/5400:1800+30", TimeControl{Mode: FISCHER, Stages: []Stage{
+			{Moves: 40, Time: 5400},
+			{Time: 1800, Increment: 30},
+		}}},
+	}
+
+	for _, tt := range inputs {
+		t.Run(tt.tag, func(t *testing.T) {
+			assert.NoError(t, tt.tc.Validate())
+			assert.Equal(t, tt.tag, tt.tc.String())
+			tc, err := ParseTimeControl(tt.tag)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.tc, tc)
+		})
+	}
+}
+
+func TestTimeControlInvalid(t *testing.T) {
+	for _, tag := range []string{"", "abc", "0", "-60", "300+", "40/:300", "*60+2", "300:300", "40/300"} {
+		_, err := ParseTimeControl(tag)
+		assert.Error(t, err, tag)
+	}
+
+	inputs := []TimeControl{
+		{Mode: "sudden", Stages: []Stage{{Time: 60}}},
+		{Mode: FISCHER},
+		{Mode: FISCHER, Stages: []Stage{{Time: 60, Increment: -1}}},
+		{Mode: FISCHER, Stages: []Stage{{Moves: 40, Time: 60}}},
+		{Mode: FISCHER, Stages: []Stage{{Time: 60}, {Time: 60}}},
+		{Mode: HOURGLASS, Stages: []Stage{{Time: 60, Increment: 1}}},
+		{Mode: FISCHER, Stages: []Stage{{Time: 10}}},
+		{Mode: FISCHER, Stages: []Stage{{Time: 60 * 60 * 24}}},
+		{Mode: FISCHER, Stages: []Stage{{Time: 60, Increment: 600}}},
+		{Mode: FISCHER, Stages: []Stage{{Moves: 1000, Time: 60}, {Time: 60}}},
+	}
+	for _, tc := range inputs {
+		assert.Error(t, tc.Validate(), tc)
+	}
+}
+
+func TestTimeControlStage(t *testing.T) {
+	tc := TimeControl{Mode: FISCHER, Stages: []Stage{
+		{Moves: 40, Time: 5400},
+		{Moves: 20, Time: 1800},
+		{Time: 900, Increment: 30},
+	}}
+	assert.Equal(t, 0, tc.stage(0))
+	assert.Equal(t, 0, tc.stage(39))
+	assert.Equal(t, 1, tc.stage(40))
+	assert.Equal(t, 1, tc.stage(59))
+	assert.Equal(t, 2, tc.stage(60))
+	assert.Equal(t, 2, tc.stage(500))
+}
+
+func TestTimeControlEstimate(t *testing.T) {
+	assert.Equal(t, 60, FischerTimeControl(60, 0).Estimate())
+	assert.Equal(t, 180+80, FischerTimeControl(180, 2).Estimate())
+	assert.Equal(t, 7200, TimeControl{Mode: FISCHER, Stages: []Stage{
+		{Moves: 40, Time: 5400},
+		{Time: 1800, Increment: 30},
+	}}.Estimate())
+}
+
+func TestTimeControlSimilar(t *testing.T) {
+	inputs := []struct {
+		a, b      TimeControl
+		tolerance float64
+		similar   bool
+	}{
+		{FischerTimeControl(300, 2), FischerTimeControl(300, 2), 0, true},
+		{FischerTimeControl(300, 2), FischerTimeControl(280, 2), 0, false},
+		{FischerTimeControl(300, 2), FischerTimeControl(280, 2), 0.1, true},
+		{FischerTimeControl(300, 2), FischerTimeControl(200, 2), 0.1, false},
+		{FischerTimeControl(300, 0), FischerTimeControl(300, 2), 0.5, false},
+		{FischerTimeControl(300, 5), TimeControl{Mode: DELAY, Stages: []Stage{{Time: 300, Increment: 5}}}, 1, false},
+	}
+
+	for _, tt := range inputs {
+		assert.Equal(t, tt.similar, tt.a.Similar(tt.b, tt.tolerance), "%s %s", tt.a, tt.b)
+		assert.Equal(t, tt.similar, tt.b.Similar(tt.a, tt.tolerance), "%s %s", tt.b, tt.a)
+	}
+}
@@ -1,9 +1,11 @@
 package websocket
 
 import (
+	"github.com/JDRadatti/reptile/internal/auth"
 	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
+	"time"
 )
 
 type WSHandler struct {
@@ -23,25 +25,38 @@ func (ws *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player, response, ok := ws.handshake(conn)
-	if message, success := marshal(response); success {
-		if err := conn.WriteMessage(messageType, message); err != nil {
-			log.Printf("error: %v", err)
+	player, response, ok := ws.handshake(conn, auth.RequestToken(r))
+	if !ok {
+		if message, success := marshal(response); success {
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				log.Printf("error: %v", err)
+			}
 		}
-	} else {
-		log.Println(err)
+		conn.Close()
 		return
 	}
 
-	if ok {
-		player.game.join <- player
-		go player.write()
+	// the game sends the join response, see Game.play
+	if !player.spectator {
+		player.notifier = ws.Lobby.subscribe(ws.Lobby.Handle(player.id))
+	}
+	go player.write()
+	game := player.game.Load()
+	select {
+	case game.join <- player:
 		go player.read()
+	case <-game.done:
+		player.send <- handshakeFail()
+		close(player.send)
 	}
-
 }
 
-func (ws *WSHandler) handshake(conn *websocket.Conn) (*Player, *Outbound, bool) {
+// handshake reads the first message on conn and returns the player of
+// the seat or session token, from the message or the request, or the
+// response to fail with.
+// A player without a token can take a free seat as a new anonymous
+// player, a player id without a token is rejected.
+func (ws *WSHandler) handshake(conn *websocket.Conn, token string) (*Player, *Outbound, bool) {
 
 	_, message, err := conn.ReadMessage()
 	if err != nil {
@@ -52,53 +67,97 @@ func (ws *WSHandler) handshake(conn *websocket.Conn) (*Player, *Outbound, bool)
 	}
 
 	in, ok := unmarshal(message)
-	if !ok || in.Action != JOIN {
+	if !ok || (in.Action != JOIN && in.Action != WATCH) {
 		log.Printf("error: %v", err)
 		return nil, handshakeFail(), false
 	}
 
-	if game, ok := ws.Lobby.GetGameFromPlayerID(in.PlayerID); ok {
+	if in.Action == WATCH {
+		return ws.watch(conn)
+	}
+
+	if in.Token != "" {
+		token = in.Token
+	}
+	var pid PlayerID
+	if token != "" {
+		if pid, err = ws.Lobby.Authenticate(token); err != nil {
+			log.Printf("error: %v", err)
+			return nil, handshakeFail(), false
+		}
+	} else if in.PlayerID != "" {
+		log.Println("unsigned player id", in.PlayerID)
+		return nil, handshakeFail(), false
+	}
+
+	if game, ok := ws.Lobby.GetGameFromPlayerID(pid); ok {
 		player := NewPlayer(ws.Lobby, conn, game)
-		player.id = in.PlayerID
-		return player, handshakeSuccess(in.PlayerID, game), true
+		player.id = pid
+		return player, nil, true
 	}
 
 	// Player not already in game (opened game link)
+	if ws.Lobby.Draining() {
+		return nil, handshakeFail(), false
+	}
 	if game, ok := ws.Lobby.GetGameFromGameID(ws.GameID); ok {
 
-		if ok := in.PlayerID.validate(); ok {
-			in.PlayerID = GeneratePlayerID()
+		newPlayer := pid == ""
+		if newPlayer {
+			pid = GeneratePlayerID()
 		}
 
-		if _, ok := game.addPlayerID(in.PlayerID); !ok {
+		if !ws.Lobby.Join(pid, game) {
+			return nil, handshakeFail(), false
+		} else if _, ok := game.takeSeat(pid, -1, ""); !ok {
+			ws.Lobby.leave(pid, game)
 			return nil, handshakeFail(), false
 		}
-
-		ws.Lobby.Join(in.PlayerID, game)
+		ws.Lobby.removeFromPool(game) // the link was used instead of the seek board
 
 		player := NewPlayer(ws.Lobby, conn, game)
-		player.id = in.PlayerID
-		return player, handshakeSuccess(in.PlayerID, game), true
+		player.id = pid
+		if newPlayer {
+			player.token = ws.Lobby.SeatToken(pid)
+		}
+		return player, nil, true
 	}
 
 	return nil, handshakeFail(), false
 }
 
+// watch joins the game as a spectator with a new id
+func (ws *WSHandler) watch(conn *websocket.Conn) (*Player, *Outbound, bool) {
+	game, ok := ws.Lobby.GetGameFromGameID(ws.GameID)
+	if !ok {
+		return nil, handshakeFail(), false
+	}
+
+	player := NewPlayer(ws.Lobby, conn, game)
+	player.id = GeneratePlayerID()
+	player.spectator = true
+	return player, nil, true
+}
+
 func handshakeFail() *Outbound {
 	return &Outbound{
 		Action: JOIN_FAIL,
 	}
 }
 
-func handshakeSuccess(pid PlayerID, g *Game) *Outbound {
+// handshakeSuccess returns the join response of pid, only the game loop
+// of g may call it
+func handshakeSuccess(l *Lobby, pid PlayerID, g *Game) *Outbound {
 	return &Outbound{
-		Action:    JOIN_SUCCESS,
-		PlayerID:  pid,
-		GameID:    g.id,
-		FEN:       string(g.board.FEN()),
-		Turn:      g.board.Turn(),
-		WhiteTime: g.timeRemaining[whiteIndex],
-		BlackTime: g.timeRemaining[blackIndex],
-		Player:    g.playerType(pid),
+		Action:      JOIN_SUCCESS,
+		PlayerID:    pid,
+		Handle:      l.Handle(pid),
+		GameID:      g.id,
+		FEN:         string(g.board.FEN()),
+		Turn:        g.board.Turn(),
+		WhiteTime:   g.clock.Millis(whiteIndex, time.Now()),
+		BlackTime:   g.clock.Millis(blackIndex, time.Now()),
+		Player:      g.playerType(pid),
+		TimeControl: g.options.TimeControl.String(),
 	}
 }
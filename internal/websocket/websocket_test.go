@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/JDRadatti/reptile/internal/auth"
 	"github.com/JDRadatti/reptile/internal/chess"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -29,8 +31,8 @@ type testCase struct {
 
 // valid handshakes:
 // gameID in lobby, no playerID but game not full
-// gameID in lobby, playerID in game
-// gameID in lobby, invalid playerID but game not full
+// gameID in lobby, seat token of a player in game
+// gameID in lobby, seat token of a player not in game but game not full
 //
 // invalid handshakes:
 // no handshake message
@@ -49,21 +51,26 @@ func TestHandshake(t *testing.T) {
 	success := make([]Outbound, players)
 	fail := make([]Outbound, players)
 	player := []chess.Player{chess.WHITE, chess.BLACK, chess.INVALID_PLAYER}
+	accounts, _ := auth.NewAccounts("")
+	withAuth := WithAuth(accounts, auth.NewSigner([]byte("handshake")))
+	signer := NewLobby(withAuth)
 	for i := range players {
 		playerID := GeneratePlayerID()
 		j := &Inbound{
-			Action:   JOIN,
-			PlayerID: playerID,
+			Action: JOIN,
+			Token:  signer.SeatToken(playerID),
 		}
 		s := Outbound{
-			Action:    JOIN_SUCCESS,
-			FEN:       string(startingFEN),
-			WhiteTime: time,
-			BlackTime: time,
-			Increment: increment,
-			PlayerID:  playerID,
-			GameID:    "0",
-			Player:    player[i],
+			Action:      JOIN_SUCCESS,
+			FEN:         string(startingFEN),
+			WhiteTime:   time * 1000,
+			BlackTime:   time * 1000,
+			Increment:   increment,
+			PlayerID:    playerID,
+			Handle:      signer.Handle(playerID),
+			TimeControl: "180",
+			GameID:      "0",
+			Player:      player[i],
 		}
 		f := Outbound{
 			Action: JOIN_FAIL,
@@ -150,11 +157,11 @@ func TestHandshake(t *testing.T) {
 	}
 
 	for _, tt := range inputs {
-		l := NewLobby()
+		l := NewLobby(withAuth)
 		var game *Game
 		if tt.createGame {
-			game = NewGame(l, tt.time, tt.inc)
-			game.id = GameID(tt.gameID)
+			game = newGame(l, GameOptions{TimeControl: FischerTimeControl(tt.time, tt.inc), Variant: STANDARD}, GameID(tt.gameID))
+			l.run(game)
 		}
 
 		t.Run(tt.name, func(t *testing.T) {
@@ -168,7 +175,7 @@ func TestHandshake(t *testing.T) {
 
 				if game != nil && tt.join[i] {
 					l.Join(tt.playerID[i], game)
-					game.addPlayerID(tt.playerID[i])
+					game.takeSeat(tt.playerID[i], -1, "")
 				}
 				for j, inbound := range tt.inbounds[i] {
 					sendMessage(t, conn, inbound)
@@ -194,9 +201,9 @@ func TestHandshake(t *testing.T) {
 			// Clean and test Clean worked
 			for i := range tt.inbounds {
 				l.Clean(GameID(tt.gameID), PlayerID(tt.playerID[i]), "")
-				_, ok := l.Players[PlayerID(tt.playerID[i])]
+				_, ok := l.GetGameFromPlayerID(PlayerID(tt.playerID[i]))
 				assert.Equal(t, false, ok)
-				_, ok = l.Games[GameID(tt.gameID)]
+				_, ok = l.GetGameFromGameID(GameID(tt.gameID))
 				assert.Equal(t, false, ok)
 			}
 		})
@@ -257,3 +264,99 @@ func receiveWSMessage(t *testing.T, conn *websocket.Conn) Outbound {
 
 	return response
 }
+
+// connect performs a successful handshake for playerID on the game
+// returned by the lobby and returns the connection
+func connect(t *testing.T, l *Lobby, gameID GameID, playerID PlayerID) *websocket.Conn {
+	t.Helper()
+
+	s, conn := newWSServer(t, &WSHandler{Lobby: l, GameID: gameID})
+	t.Cleanup(func() {
+		conn.Close()
+		s.Close()
+	})
+
+	sendMessage(t, conn, &Inbound{Action: JOIN, Token: l.SeatToken(playerID)})
+	if out := receiveWSMessage(t, conn); out.Action != JOIN_SUCCESS {
+		t.Fatalf("handshake failed: %v", out)
+	}
+	return conn
+}
+
+// receiveAction reads messages until one with the given action arrives,
+// skipping messages like TIME_UPDATE
+func receiveAction(t *testing.T, conn *websocket.Conn, action string) Outbound {
+	t.Helper()
+
+	for {
+		if out := receiveWSMessage(t, conn); out.Action == action {
+			return out
+		}
+	}
+}
+
+func TestHandshakeToken(t *testing.T) {
+	l := NewLobby()
+	account, err := l.Accounts.Register("player", "password")
+	assert.NoError(t, err)
+	pid := PlayerID(account.PlayerID)
+	game := NewGame(l, defaultGameOptions)
+	game.takeSeat(pid, -1, "")
+	l.Join(pid, game)
+
+	join := func(in *Inbound) Outbound {
+		s, conn := newWSServer(t, &WSHandler{Lobby: l, GameID: game.id})
+		t.Cleanup(func() {
+			conn.Close()
+			s.Close()
+		})
+		sendMessage(t, conn, in)
+		return receiveWSMessage(t, conn)
+	}
+
+	// the id of an account is not enough
+	assert.Equal(t, JOIN_FAIL, join(&Inbound{Action: JOIN, PlayerID: pid}).Action)
+	forged := NewLobby().Signer.Sign(auth.SESSION, string(pid), time.Now().Add(time.Hour))
+	assert.Equal(t, JOIN_FAIL, join(&Inbound{Action: JOIN, PlayerID: pid, Token: forged}).Action)
+
+	// nor a seat token for an account
+	assert.Equal(t, JOIN_FAIL, join(&Inbound{Action: JOIN, Token: l.SeatToken(pid)}).Action)
+
+	token := l.Signer.Sign(auth.SESSION, string(pid), time.Now().Add(time.Hour))
+	out := join(&Inbound{Action: JOIN, Token: token})
+	assert.Equal(t, JOIN_SUCCESS, out.Action)
+	assert.Equal(t, pid, out.PlayerID)
+	assert.Equal(t, "player", out.Handle)
+	assert.Empty(t, out.Token)
+}
+
+func TestHandshakeSeat(t *testing.T) {
+	l := NewLobby()
+	game := NewGame(l, defaultGameOptions)
+	l.mu.Lock()
+	l.games[game.id] = game
+	l.mu.Unlock()
+	join := func(in *Inbound) Outbound {
+		s, conn := newWSServer(t, &WSHandler{Lobby: l, GameID: game.id})
+		t.Cleanup(func() {
+			conn.Close()
+			s.Close()
+		})
+		sendMessage(t, conn, in)
+		return receiveWSMessage(t, conn)
+	}
+
+	// unsigned and tampered tokens are rejected
+	assert.Equal(t, JOIN_FAIL, join(&Inbound{Action: JOIN, PlayerID: GeneratePlayerID()}).Action)
+	token := l.SeatToken(GeneratePlayerID())
+	assert.Equal(t, JOIN_FAIL, join(&Inbound{Action: JOIN, Token: token + "x"}).Action)
+
+	// a player opening the link without a token gets a new seat
+	out := join(&Inbound{Action: JOIN})
+	assert.Equal(t, JOIN_SUCCESS, out.Action)
+	pid, err := l.Authenticate(out.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, out.PlayerID, pid)
+	assert.Equal(t, l.Handle(pid), out.Handle)
+	assert.NotContains(t, out.Handle, string(pid))
+}